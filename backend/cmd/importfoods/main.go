@@ -0,0 +1,79 @@
+// loads a USDA FoodData Central bulk download into the foods table, for the
+// "local" nutrition provider:
+//
+//	go run ./cmd/importfoods -csv ./FoodData_Central_csv_2024-10-31
+//	go run ./cmd/importfoods -json ./FoodData_Central_sr_legacy_food_json_2021-10-28.json
+//
+// safe to re-run, foods are updated by their fdc id.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/foods"
+)
+
+func main() {
+	csvDir := flag.String("csv", "", "directory of the unzipped CSV download")
+	jsonFile := flag.String("json", "", "one of the JSON downloads")
+	types := flag.String("types", strings.Join(foods.DefaultDataTypes, ","), "data types to import (branded_food is huge)")
+	batchSize := flag.Int("batch", 500, "foods per transaction")
+	flag.Parse()
+
+	if (*csvDir == "") == (*jsonFile == "") {
+		log.Fatal("pass exactly one of -csv or -json")
+	}
+
+	db.Connect()
+	store := foods.NewStore(db.DB)
+	ctx := context.Background()
+
+	var batch []foods.Food
+	total := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := store.Import(ctx, batch); err != nil {
+			return err
+		}
+		total += len(batch)
+		batch = batch[:0]
+		fmt.Printf("\rimported %d foods", total)
+		return nil
+	}
+	add := func(f foods.Food) error {
+		batch = append(batch, f)
+		if len(batch) >= *batchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	dataTypes := strings.Split(*types, ",")
+	var err error
+	if *csvDir != "" {
+		err = foods.ReadCSV(*csvDir, dataTypes, add)
+	} else {
+		var f *os.File
+		f, err = os.Open(*jsonFile)
+		if err == nil {
+			defer f.Close()
+			err = foods.ReadJSON(f, dataTypes, add)
+		}
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		log.Fatal("\nimport failed: ", err)
+	}
+
+	fmt.Printf("\r✅ imported %d foods\n", total)
+}
@@ -0,0 +1,63 @@
+// generates a jwt signing key for JWT_KEYS_DIR:
+//
+//	go run ./cmd/keygen -alg EdDSA -dir ./keys
+//
+// then set JWT_SIGNING_KID to the printed kid and restart the server.
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	alg := flag.String("alg", "EdDSA", "EdDSA or RS256")
+	dir := flag.String("dir", "keys", "directory to write the key to")
+	kid := flag.String("kid", time.Now().Format("2006-01-02"), "key id (becomes the file name)")
+	flag.Parse()
+
+	var priv crypto.Signer
+	var err error
+	switch *alg {
+	case "EdDSA":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		priv, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		log.Fatalf("unsupported -alg %q, use EdDSA or RS256", *alg)
+	}
+	if err != nil {
+		log.Fatal("key generation failed: ", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.MkdirAll(*dir, 0o700); err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(*dir, *kid+".pem")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("wrote %s (kid %q)\n", path, *kid)
+}
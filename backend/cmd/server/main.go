@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
@@ -11,6 +12,11 @@ import (
 	"itami-hypertrophy/internal/cache"
 	"itami-hypertrophy/internal/db"
 	"itami-hypertrophy/internal/handler"
+	"itami-hypertrophy/internal/keys"
+	"itami-hypertrophy/internal/mail"
+	"itami-hypertrophy/internal/nutrition"
+	"itami-hypertrophy/internal/oidc"
+	"itami-hypertrophy/internal/user"
 )
 
 func main() {
@@ -18,32 +24,75 @@ func main() {
 	fmt.Println("Using DB_URL:", os.Getenv("DB_URL"))
 	db.Connect()
 	cache.InitRedis()
+	mail.Init()
+	keys.Init()
+	oidc.Init()
+	nutrition.Init()
+	handler.Users = user.NewService(user.NewPostgresRepository(db.DB), user.PolicyFromEnv())
+	handler.Users.ReuseCooldown = user.ReuseCooldownFromEnv()
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "pong")
 	})
-	mux.HandleFunc("/register", handler.Register)
+	mux.HandleFunc("/.well-known/jwks.json", handler.JWKS)
+	mux.HandleFunc("/register", handler.Register) // backs off per ip by itself, like /login
 	mux.HandleFunc("/login", handler.Login)
-	mux.HandleFunc("/profile", handler.JWTMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		email := r.Context().Value(handler.UserEmailKey).(string)
-		w.Write([]byte("Hello, " + email + "! This is your profile."))
-	}))
-	mux.HandleFunc("/log-calories", handler.JWTMiddleware(handler.LogCalories))
-	mux.HandleFunc("/meals", handler.JWTMiddleware(handler.GetMeals))
-	mux.HandleFunc("/meals/today", handler.JWTMiddleware(handler.GetTodayMeals))
-	mux.HandleFunc("/log-strength", handler.JWTMiddleware(handler.LogStrengthWorkout))
-	mux.HandleFunc("/dashboard", handler.JWTMiddleware(handler.GetDashboardByDate))
-	mux.HandleFunc("/dashboard/weekly", handler.JWTMiddleware(handler.GetWeeklyDashboard))
-	mux.HandleFunc("/goals", handler.JWTMiddleware(handler.GetGoals))
-	mux.HandleFunc("/goals/set", handler.JWTMiddleware(handler.SetGoals))
+	mux.HandleFunc("/login/mfa", handler.LoginMFA)
+	mux.HandleFunc("/login/oidc", handler.LoginOIDC)
+	mux.HandleFunc("/oidc/providers", handler.ListOIDCProviders)
+	mux.HandleFunc("/oidc/{provider}/login", handler.OIDCLogin)
+	mux.HandleFunc("/oidc/{provider}/callback", handler.OIDCCallback)
+	mux.HandleFunc("/token/refresh", handler.RefreshToken)
+	mux.HandleFunc("/logout", handler.JWTMiddleware(handler.Logout))
+	mux.HandleFunc("/sessions", handler.JWTMiddleware(handler.GetSessions))
+	mux.HandleFunc("/sessions/{id}", handler.JWTMiddleware(handler.RevokeSession))
+	mux.HandleFunc("/password/forgot", handler.RateLimitByIP(5, time.Hour, handler.ForgotPassword))
+	mux.HandleFunc("/password/reset", handler.ResetPassword)
+	mux.HandleFunc("/password/change", handler.JWTMiddleware(handler.ChangePassword))
+	mux.HandleFunc("/verify", handler.VerifyEmail)
+	mux.HandleFunc("/verify/resend", handler.RateLimitByIP(5, time.Hour, handler.ResendVerification))
+	mux.HandleFunc("/profile", handler.JWTMiddleware(handler.ProfileHandler))
+	mux.HandleFunc("/account", handler.JWTMiddleware(handler.DeleteAccount))
+	mux.HandleFunc("/account/export", handler.JWTMiddleware(handler.ExportAccount))
+	mux.HandleFunc("/account/email", handler.JWTMiddleware(handler.ChangeEmail))
+	mux.HandleFunc("/2fa/setup", handler.JWTMiddleware(handler.SetupMFA))
+	mux.HandleFunc("/2fa/enable", handler.JWTMiddleware(handler.EnableMFA))
+	mux.HandleFunc("/2fa/disable", handler.JWTMiddleware(handler.DisableMFA))
+	mux.HandleFunc("/2fa/recovery-codes", handler.JWTMiddleware(handler.RegenerateRecoveryCodes))
+	mux.HandleFunc("/tokens", handler.JWTMiddleware(handler.TokensHandler))
+	mux.HandleFunc("/tokens/{id}", handler.JWTMiddleware(handler.RevokeToken))
+	mux.HandleFunc("/coaching/invitations", handler.JWTMiddleware(handler.InvitationsHandler))
+	mux.HandleFunc("/coaching/invitations/{id}/accept", handler.JWTMiddleware(handler.AcceptInvitation))
+	mux.HandleFunc("/coaching/invitations/{id}/decline", handler.JWTMiddleware(handler.DeclineInvitation))
+	mux.HandleFunc("/coaching/links", handler.JWTMiddleware(handler.ListCoachLinks))
+	mux.HandleFunc("/coaching/links/{id}", handler.JWTMiddleware(handler.EndCoachLink))
+	mux.HandleFunc("/coaching/access-log", handler.JWTMiddleware(handler.GetCoachAccessLog))
+	mux.HandleFunc("/nutrition/cache-stats", handler.JWTMiddleware(handler.GetNutritionCacheStats))
+	mux.HandleFunc("/log-calories", handler.ScopedAuth("meals:write", handler.LogCalories))
+	mux.HandleFunc("/meals", handler.ScopedAuth("meals:read", handler.AthleteAccess(handler.GetMeals)))
+	mux.HandleFunc("/meal-items/{id}", handler.ScopedAuth("meals:write", handler.MealItemHandler))
+	mux.HandleFunc("/meals/{id}", handler.ScopedAuth("meals:write", handler.MealHandler))
+	mux.HandleFunc("/meals/today", handler.ScopedAuth("meals:read", handler.AthleteAccess(handler.GetTodayMeals)))
+	// split by method so a meals:read token can list recipes but not create them
+	mux.HandleFunc("GET /recipes", handler.ScopedAuth("meals:read", handler.AthleteAccess(handler.ListRecipes)))
+	mux.HandleFunc("POST /recipes", handler.ScopedAuth("meals:write", handler.CreateRecipe))
+	mux.HandleFunc("GET /recipes/{id}", handler.ScopedAuth("meals:read", handler.AthleteAccess(handler.GetRecipe)))
+	mux.HandleFunc("DELETE /recipes/{id}", handler.ScopedAuth("meals:write", handler.DeleteRecipe))
+	mux.HandleFunc("/recipes/{id}/log", handler.ScopedAuth("meals:write", handler.LogRecipe))
+	mux.HandleFunc("/log-strength", handler.ScopedAuth("workouts:write", handler.LogStrengthWorkout))
+	mux.HandleFunc("/workouts", handler.ScopedAuth("workouts:read", handler.AthleteAccess(handler.GetWorkouts)))
+	mux.HandleFunc("/dashboard", handler.ScopedAuth("dashboard:read", handler.AthleteAccess(handler.GetDashboardByDate)))
+	mux.HandleFunc("/dashboard/weekly", handler.ScopedAuth("dashboard:read", handler.AthleteAccess(handler.GetWeeklyDashboard)))
+	mux.HandleFunc("/goals", handler.ScopedAuth("goals:read", handler.AthleteAccess(handler.GetGoals)))
+	mux.HandleFunc("/goals/set", handler.ScopedAuth("goals:write", handler.SetGoals))
 
 	// ✅ Enable CORS for frontend
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-CSRF-Token"},
 		AllowCredentials: true,
 	})
 
@@ -0,0 +1,125 @@
+// Package foods is the local food database: what's in it (foods + portion
+// sizes), how to search it, and how to fill it from the USDA FoodData Central
+// bulk downloads.
+package foods
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrNotFound = errors.New("food not found")
+
+type Food struct {
+	ID       int
+	FdcID    int
+	Name     string
+	DataType string
+	// per 100 g
+	Calories float64
+	Protein  float64
+	Carbs    float64
+	Fat      float64
+	Portions []Portion
+}
+
+// "1 cup, chopped" = 91 g, Grams is always for a single unit
+type Portion struct {
+	Label string
+	Grams float64
+}
+
+type Store struct {
+	DB *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{DB: db}
+}
+
+// best match for a free-text name: every word has to appear, then the
+// best-ranked and, among those, the shortest (= most generic) name wins
+func (s *Store) Search(ctx context.Context, query string) (Food, error) {
+	var f Food
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, fdc_id, name, data_type, calories, protein, carbs, fat
+		FROM foods, plainto_tsquery('english', $1) q
+		WHERE search @@ q
+		ORDER BY ts_rank(search, q) DESC, length(name) ASC
+		LIMIT 1
+	`, query).Scan(&f.ID, &f.FdcID, &f.Name, &f.DataType, &f.Calories, &f.Protein, &f.Carbs, &f.Fat)
+	if err == sql.ErrNoRows {
+		return Food{}, ErrNotFound
+	}
+	if err != nil {
+		return Food{}, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, "SELECT label, grams FROM food_portions WHERE food_id = $1 ORDER BY seq, id", f.ID)
+	if err != nil {
+		return Food{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Portion
+		if err := rows.Scan(&p.Label, &p.Grams); err != nil {
+			return Food{}, err
+		}
+		f.Portions = append(f.Portions, p)
+	}
+	return f, rows.Err()
+}
+
+// inserts or refreshes foods by fdc_id, their portions are replaced.
+// one transaction per call, so callers should batch
+func (s *Store) Import(ctx context.Context, batch []Food) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsert, err := tx.PrepareContext(ctx, `
+		INSERT INTO foods (fdc_id, name, data_type, calories, protein, carbs, fat)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (fdc_id) DO UPDATE SET
+			name = EXCLUDED.name, data_type = EXCLUDED.data_type, calories = EXCLUDED.calories,
+			protein = EXCLUDED.protein, carbs = EXCLUDED.carbs, fat = EXCLUDED.fat
+		RETURNING id
+	`)
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+
+	clearPortions, err := tx.PrepareContext(ctx, "DELETE FROM food_portions WHERE food_id = $1")
+	if err != nil {
+		return err
+	}
+	defer clearPortions.Close()
+
+	addPortion, err := tx.PrepareContext(ctx, "INSERT INTO food_portions (food_id, seq, label, grams) VALUES ($1, $2, $3, $4)")
+	if err != nil {
+		return err
+	}
+	defer addPortion.Close()
+
+	for _, f := range batch {
+		var id int
+		err := upsert.QueryRowContext(ctx, f.FdcID, f.Name, f.DataType, f.Calories, f.Protein, f.Carbs, f.Fat).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if _, err := clearPortions.ExecContext(ctx, id); err != nil {
+			return err
+		}
+		for i, p := range f.Portions {
+			if _, err := addPortion.ExecContext(ctx, id, i, p.Label, p.Grams); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,317 @@
+package foods
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// USDA FoodData Central bulk downloads (https://fdc.nal.usda.gov/download-datasets).
+// both the CSV zip (a directory of food.csv, food_nutrient.csv, ...) and the
+// per-dataset JSON files are understood. everything is streamed, only the
+// foods being kept are held in memory.
+
+// nutrient ids as used by FDC, the same in the CSV and the JSON files
+const (
+	nutrientEnergy         = 1008
+	nutrientEnergyAtwater  = 2047 // foundation foods often only have these two
+	nutrientEnergySpecific = 2048
+	nutrientProtein        = 1003
+	nutrientCarbs          = 1005
+	nutrientFat            = 1004
+)
+
+// data types the way food.csv spells them, the JSON files spell them differently
+var jsonDataTypes = map[string]string{
+	"Foundation":     "foundation_food",
+	"SR Legacy":      "sr_legacy_food",
+	"Survey (FNDDS)": "survey_fndds_food",
+	"Branded":        "branded_food",
+}
+
+// default selection for the importer: the generic foods, not the ~2M branded ones
+var DefaultDataTypes = []string{"foundation_food", "sr_legacy_food", "survey_fndds_food"}
+
+// collects nutrient amounts while reading, energy falls back to the atwater values
+type nutrients map[int]float64
+
+func (n nutrients) apply(f *Food) {
+	for _, id := range []int{nutrientEnergy, nutrientEnergyAtwater, nutrientEnergySpecific} {
+		if v, ok := n[id]; ok {
+			f.Calories = v
+			break
+		}
+	}
+	f.Protein = n[nutrientProtein]
+	f.Carbs = n[nutrientCarbs]
+	f.Fat = n[nutrientFat]
+}
+
+// "1/2 cup" → 0.5, "2 slices" → 2, anything else → 1
+func leadingAmount(s string) float64 {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 1
+	}
+	word := fields[0]
+	if num, den, ok := strings.Cut(word, "/"); ok {
+		n, err1 := strconv.ParseFloat(num, 64)
+		d, err2 := strconv.ParseFloat(den, 64)
+		if err1 == nil && err2 == nil && n > 0 && d > 0 {
+			return n / d
+		}
+	}
+	if n, err := strconv.ParseFloat(word, 64); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// builds a portion out of FDC's amount / unit / modifier / description mess
+func makePortion(amount float64, unit, modifier, description string, gramWeight float64) (Portion, bool) {
+	if gramWeight <= 0 {
+		return Portion{}, false
+	}
+
+	var parts []string
+	if unit != "" && unit != "undetermined" {
+		parts = append(parts, unit)
+	}
+	if modifier != "" {
+		parts = append(parts, modifier)
+	}
+	if len(parts) == 0 && description != "" {
+		// survey foods only have "1 cup, NFS" style descriptions, the amount is in there
+		parts = append(parts, description)
+		if amount <= 0 {
+			amount = leadingAmount(description)
+		}
+	}
+	if len(parts) == 0 {
+		return Portion{}, false
+	}
+	if amount <= 0 {
+		amount = 1
+	}
+	return Portion{Label: strings.Join(parts, ", "), Grams: gramWeight / amount}, true
+}
+
+func keepSet(dataTypes []string) map[string]bool {
+	keep := map[string]bool{}
+	for _, t := range dataTypes {
+		keep[strings.TrimSpace(t)] = true
+	}
+	return keep
+}
+
+// reads a csv with a header row and calls fn with a column lookup per record
+func eachCSV(path string, fn func(col func(string) string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimPrefix(name, "\ufeff")] = i
+	}
+
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		col := func(name string) string {
+			if i, ok := index[name]; ok && i < len(rec) {
+				return rec[i]
+			}
+			return ""
+		}
+		if err := fn(col); err != nil {
+			return err
+		}
+	}
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func atof(s string) float64 {
+	n, _ := strconv.ParseFloat(s, 64)
+	return n
+}
+
+// reads the unzipped CSV download and calls fn once per food of the given types
+func ReadCSV(dir string, dataTypes []string, fn func(Food) error) error {
+	keep := keepSet(dataTypes)
+
+	foods := map[int]*Food{}
+	var order []int
+	err := eachCSV(filepath.Join(dir, "food.csv"), func(col func(string) string) error {
+		if !keep[col("data_type")] {
+			return nil
+		}
+		id := atoi(col("fdc_id"))
+		foods[id] = &Food{FdcID: id, Name: col("description"), DataType: col("data_type")}
+		order = append(order, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	amounts := map[int]nutrients{}
+	err = eachCSV(filepath.Join(dir, "food_nutrient.csv"), func(col func(string) string) error {
+		id := atoi(col("fdc_id"))
+		if foods[id] == nil {
+			return nil
+		}
+		switch nid := atoi(col("nutrient_id")); nid {
+		case nutrientEnergy, nutrientEnergyAtwater, nutrientEnergySpecific, nutrientProtein, nutrientCarbs, nutrientFat:
+			if amounts[id] == nil {
+				amounts[id] = nutrients{}
+			}
+			amounts[id][nid] = atof(col("amount"))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// portions are optional, branded-only downloads don't have them
+	units := map[string]string{}
+	if _, err := os.Stat(filepath.Join(dir, "measure_unit.csv")); err == nil {
+		err := eachCSV(filepath.Join(dir, "measure_unit.csv"), func(col func(string) string) error {
+			units[col("id")] = col("name")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "food_portion.csv")); err == nil {
+		err := eachCSV(filepath.Join(dir, "food_portion.csv"), func(col func(string) string) error {
+			f := foods[atoi(col("fdc_id"))]
+			if f == nil {
+				return nil
+			}
+			p, ok := makePortion(atof(col("amount")), units[col("measure_unit_id")], col("modifier"),
+				col("portion_description"), atof(col("gram_weight")))
+			if ok {
+				f.Portions = append(f.Portions, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range order {
+		f := foods[id]
+		amounts[id].apply(f)
+		if err := fn(*f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonFood struct {
+	FdcID         int    `json:"fdcId"`
+	Description   string `json:"description"`
+	DataType      string `json:"dataType"`
+	FoodNutrients []struct {
+		Nutrient struct {
+			ID int `json:"id"`
+		} `json:"nutrient"`
+		Amount float64 `json:"amount"`
+	} `json:"foodNutrients"`
+	FoodPortions []struct {
+		Amount             float64 `json:"amount"`
+		GramWeight         float64 `json:"gramWeight"`
+		Modifier           string  `json:"modifier"`
+		PortionDescription string  `json:"portionDescription"`
+		MeasureUnit        struct {
+			Name string `json:"name"`
+		} `json:"measureUnit"`
+	} `json:"foodPortions"`
+	// branded foods have a single label serving instead of portions
+	ServingSize              float64 `json:"servingSize"`
+	ServingSizeUnit          string  `json:"servingSizeUnit"`
+	HouseholdServingFullText string  `json:"householdServingFullText"`
+}
+
+// reads one of the JSON downloads ({"SRLegacyFoods": [...]} and friends)
+// and calls fn once per food of the given types
+func ReadJSON(r io.Reader, dataTypes []string, fn func(Food) error) error {
+	keep := keepSet(dataTypes)
+	dec := json.NewDecoder(r)
+
+	// walk into the first array in the file, whatever its key is called
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("no food list found: %w", err)
+		}
+		if d, ok := tok.(json.Delim); ok && d == '[' {
+			break
+		}
+	}
+
+	for dec.More() {
+		var jf jsonFood
+		if err := dec.Decode(&jf); err != nil {
+			return err
+		}
+
+		dataType := jsonDataTypes[jf.DataType]
+		if dataType == "" {
+			dataType = jf.DataType
+		}
+		if !keep[dataType] {
+			continue
+		}
+
+		f := Food{FdcID: jf.FdcID, Name: jf.Description, DataType: dataType}
+		n := nutrients{}
+		for _, fnut := range jf.FoodNutrients {
+			n[fnut.Nutrient.ID] = fnut.Amount
+		}
+		n.apply(&f)
+
+		for _, jp := range jf.FoodPortions {
+			if p, ok := makePortion(jp.Amount, jp.MeasureUnit.Name, jp.Modifier, jp.PortionDescription, jp.GramWeight); ok {
+				f.Portions = append(f.Portions, p)
+			}
+		}
+		if jf.HouseholdServingFullText != "" && strings.EqualFold(jf.ServingSizeUnit, "g") {
+			if p, ok := makePortion(0, "", "", jf.HouseholdServingFullText, jf.ServingSize); ok {
+				f.Portions = append(f.Portions, p)
+			}
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package foods
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLeadingAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"1/2 cup", 0.5},
+		{"2 slices", 2},
+		{"1.5 oz", 1.5},
+		{"cup, NFS", 1},
+		{"0 cups", 1},
+		{"1/0 cup", 1},
+		{"", 1},
+	}
+	for _, tt := range tests {
+		if got := leadingAmount(tt.in); got != tt.want {
+			t.Errorf("leadingAmount(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMakePortion(t *testing.T) {
+	tests := []struct {
+		name                        string
+		amount                      float64
+		unit, modifier, description string
+		gramWeight                  float64
+		want                        Portion
+		ok                          bool
+	}{
+		{"unit", 1, "cup", "", "", 240, Portion{"cup", 240}, true},
+		{"per one of the amount", 2, "slice", "", "", 50, Portion{"slice", 25}, true},
+		{"unit and modifier", 1, "cup", "chopped", "", 150, Portion{"cup, chopped", 150}, true},
+		{"undetermined unit", 1, "undetermined", "large", "", 50, Portion{"large", 50}, true},
+		{"survey description", 0, "", "", "1/2 cup, NFS", 100, Portion{"1/2 cup, NFS", 200}, true},
+		{"no amount", 0, "cup", "", "", 240, Portion{"cup", 240}, true},
+		{"no weight", 1, "cup", "", "", 0, Portion{}, false},
+		{"no label", 1, "", "", "", 100, Portion{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := makePortion(tt.amount, tt.unit, tt.modifier, tt.description, tt.gramWeight)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("got %+v %v, want %+v %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func collect(t *testing.T, read func(fn func(Food) error) error) []Food {
+	t.Helper()
+	var got []Food
+	if err := read(func(f Food) error {
+		got = append(got, f)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestReadCSV(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		// the BOM is what the real downloads start with
+		"food.csv": "\ufefffdc_id,data_type,description\n" +
+			"1,sr_legacy_food,Banana\n" +
+			"2,branded_food,Choco Bar\n" +
+			"3,foundation_food,Egg\n",
+		"food_nutrient.csv": "id,fdc_id,nutrient_id,amount\n" +
+			"10,1,1008,89\n" +
+			"11,1,1003,1.1\n" +
+			"12,1,1005,22.8\n" +
+			"13,1,1004,0.3\n" +
+			"14,1,1093,1\n" +
+			"15,2,1008,500\n" +
+			"16,3,2047,143\n" +
+			"17,3,1003,12.6\n",
+		"measure_unit.csv": "id,name\n1000,cup\n9999,undetermined\n",
+		"food_portion.csv": "id,fdc_id,amount,measure_unit_id,modifier,portion_description,gram_weight\n" +
+			"1,1,1,1000,sliced,,150\n" +
+			"2,3,1,9999,large,,50\n" +
+			"3,3,1,1000,,,0\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := collect(t, func(fn func(Food) error) error { return ReadCSV(dir, DefaultDataTypes, fn) })
+	want := []Food{
+		{FdcID: 1, Name: "Banana", DataType: "sr_legacy_food", Calories: 89, Protein: 1.1, Carbs: 22.8, Fat: 0.3,
+			Portions: []Portion{{"cup, sliced", 150}}},
+		{FdcID: 3, Name: "Egg", DataType: "foundation_food", Calories: 143, Protein: 12.6,
+			Portions: []Portion{{"large", 50}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	data := `{"SRLegacyFoods": [
+		{"fdcId": 1, "description": "Banana", "dataType": "SR Legacy",
+		 "foodNutrients": [
+			{"nutrient": {"id": 1008}, "amount": 89},
+			{"nutrient": {"id": 1003}, "amount": 1.1}
+		 ],
+		 "foodPortions": [
+			{"amount": 1, "gramWeight": 150, "modifier": "sliced", "measureUnit": {"name": "cup"}}
+		 ]},
+		{"fdcId": 2, "description": "Choco Bar", "dataType": "Branded",
+		 "foodNutrients": [{"nutrient": {"id": 1008}, "amount": 500}],
+		 "servingSize": 40, "servingSizeUnit": "g", "householdServingFullText": "1 bar"}
+	]}`
+
+	got := collect(t, func(fn func(Food) error) error {
+		return ReadJSON(strings.NewReader(data), DefaultDataTypes, fn)
+	})
+	want := []Food{
+		{FdcID: 1, Name: "Banana", DataType: "sr_legacy_food", Calories: 89, Protein: 1.1,
+			Portions: []Portion{{"cup, sliced", 150}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	// branded foods come with their label serving
+	got = collect(t, func(fn func(Food) error) error {
+		return ReadJSON(strings.NewReader(data), []string{"branded_food"}, fn)
+	})
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Portions, []Portion{{"1 bar", 40}}) {
+		t.Errorf("branded: got %+v", got)
+	}
+
+	if err := ReadJSON(strings.NewReader(`{"foods": {}}`), DefaultDataTypes, func(Food) error { return nil }); err == nil {
+		t.Error("a file without a food list was accepted")
+	}
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"itami-hypertrophy/internal/cache"
+	"itami-hypertrophy/internal/user"
+)
+
+// re-confirms the password for sensitive account actions, writes the error itself
+func checkPassword(w http.ResponseWriter, userID int, password string) bool {
+	_, err := Users.CheckPassword(userID, password)
+	switch err {
+	case nil:
+		return true
+	case user.ErrInvalidCredentials:
+		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+	case user.ErrNotFound:
+		http.Error(w, "User not found", http.StatusNotFound)
+	default:
+		http.Error(w, "DB error", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// proves a sensitive request comes from the account owner: the password, or a
+// reauth_code from a fresh oidc sign-in (accounts made through oidc have no password)
+type ownerProof struct {
+	Password   string `json:"password"`
+	ReauthCode string `json:"reauth_code"`
+}
+
+func (p ownerProof) given() bool { return p.Password != "" || p.ReauthCode != "" }
+
+// checks whichever proof was sent, writes the error itself
+func confirmOwner(w http.ResponseWriter, userID int, p ownerProof) bool {
+	if p.ReauthCode != "" {
+		return checkReauthCode(w, userID, p.ReauthCode)
+	}
+	return checkPassword(w, userID, p.Password)
+}
+
+type deleteAccountRequest struct {
+	ownerProof
+}
+
+// SCAN + DEL, KEYS would block redis on a big keyspace
+func deleteKeys(pattern string) error {
+	iter := cache.Rdb.Scan(cache.Ctx, 0, pattern, 100).Iterator()
+	for iter.Next(cache.Ctx) {
+		if err := cache.Rdb.Del(cache.Ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// drops every redis key that belongs to the user (dashboards, rate limits,
+// sessions, and the login guard's counters for their address)
+func purgeUserCache(userID int, email string) error {
+	account := normalizeEmail(email)
+	err := cache.Rdb.Del(cache.Ctx, failKey("acct", account), waitKey("acct", account), lockKey(account)).Err()
+	if err != nil {
+		return err
+	}
+
+	for _, pattern := range []string{
+		fmt.Sprintf("weekly:%d:*", userID),
+		fmt.Sprintf("weekly_keys:%d", userID),
+		fmt.Sprintf("rate:%d:*", userID),
+	} {
+		if err := deleteKeys(pattern); err != nil {
+			return err
+		}
+	}
+	return revokeAllFamilies(userID)
+}
+
+type changeEmailRequest struct {
+	NewEmail string `json:"new_email"`
+	ownerProof
+}
+
+// PATCH /account/email → mail a verification link to the new address,
+// the switch only happens once that link is opened (see VerifyEmail).
+// needs the password or a reauth_code, same as DELETE /account
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Only PATCH allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	var req changeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewEmail == "" || !req.given() {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	req.NewEmail = user.NormalizeEmail(req.NewEmail)
+	if !user.ValidEmail(req.NewEmail) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	if !confirmOwner(w, userID, req.ownerProof) {
+		return
+	}
+
+	_, err := Users.ByEmail(req.NewEmail)
+	if err == nil {
+		http.Error(w, "Email already in use", http.StatusConflict)
+		return
+	}
+	if err != user.ErrNotFound {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := sendVerificationMail(userID, req.NewEmail); err != nil {
+		log.Println("verification mail failed:", err)
+		http.Error(w, "Could not send verification mail", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("Check the new address for a verification link"))
+}
+
+// DELETE /account → wipe the account and all of its data, needs the password
+// again (or a reauth_code for accounts without one)
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	var req deleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.given() {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if !confirmOwner(w, userID, req.ownerProof) {
+		return
+	}
+
+	u, err := Users.ByID(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err := Users.Delete(userID); err != nil {
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	// the rows are gone already, a leftover cache key just expires on its own
+	if err := purgeUserCache(userID, u.Email); err != nil {
+		log.Println("cache purge failed for deleted user", userID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
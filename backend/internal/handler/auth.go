@@ -2,20 +2,20 @@ package handler
 
 import (
 	"encoding/json"
-	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/user"
+	"log"
 	"net/http"
-	"os"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type creds struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Device   string `json:"device"` // optional label for the session list
 }
 
+// set up in main, every account operation goes through it
+var Users *user.Service
+
 // always remember boht maa chudi thi idhar
 func Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -30,20 +30,46 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(c.Password), bcrypt.DefaultCost)
+	ip := clientIP(r)
+	wait, err := registerWait(ip)
 	if err != nil {
-		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		http.Error(w, "Could not create account", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeTooMany(w, wait)
 		return
 	}
+	recordRegisterAttempt(ip)
 
-	_, err = db.DB.Exec("INSERT INTO users (email, password) VALUES ($1, $2)", c.Email, string(hashedPassword))
+	u, err := Users.Create(c.Email, c.Password)
+	if err == user.ErrEmailTaken {
+		http.Error(w, "Email already in use", http.StatusConflict)
+		return
+	}
+	if err == user.ErrEmailRecentlyDeleted {
+		http.Error(w, "That address belonged to an account that was just deleted, try again in a few days", http.StatusConflict)
+		return
+	}
+	if err == user.ErrInvalidEmail {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if passwordRejected(w, err) {
+		return
+	}
 	if err != nil {
-		http.Error(w, "Email already in use or DB error", http.StatusInternalServerError)
+		http.Error(w, "Could not create account", http.StatusInternalServerError)
 		return
 	}
 
+	// account is created either way, they can ask for a new link via /verify/resend
+	if err := sendVerificationMail(u.ID, u.Email); err != nil {
+		log.Println("verification mail failed:", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("User registered successfully"))
+	w.Write([]byte("User registered successfully. Check your inbox to verify your email."))
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
@@ -60,40 +86,46 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var storedHashedPassword string
-	err = db.DB.QueryRow("SELECT password FROM users WHERE email = $1", c.Email).Scan(&storedHashedPassword)
+	ip := clientIP(r)
+	account := normalizeEmail(c.Email)
+	wait, err := loginWait(ip, account)
 	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeTooMany(w, wait)
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(storedHashedPassword), []byte(c.Password))
-	if err != nil {
+	u, err := Users.Authenticate(c.Email, c.Password)
+	if err == user.ErrInvalidCredentials {
+		recordLoginFailure(ip, account)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
-
-	// jwt —okokmaybe
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email": c.Email,
-		"exp":   time.Now().Add(24 * time.Hour).Unix(),
-	})
-
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		http.Error(w, "Server error: missing JWT secret", http.StatusInternalServerError)
+	if err != nil {
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	if !u.EmailVerified && verificationPolicy() == verificationBlock {
+		http.Error(w, "Please verify your email before logging in", http.StatusForbidden)
 		return
 	}
 
-	tokenString, err := token.SignedString([]byte(secret))
+	enabled, err := mfaEnabled(u.ID)
 	if err != nil {
-		http.Error(w, "Could not sign token", http.StatusInternalServerError)
+		http.Error(w, "Login failed", http.StatusInternalServerError)
 		return
 	}
+	if enabled {
+		// password was fine, real tokens only come from /login/mfa. the failure
+		// history stays until the code is right too, see LoginMFA
+		writeMFAChallenge(w, u.ID, c.Device)
+		return
+	}
+	recordLoginSuccess(account)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": tokenString,
-	})
-
+	// jwt —okokmaybe
+	startSession(w, r, u.ID, c.Device)
 }
@@ -3,45 +3,113 @@ package handler
 import (
 	"context"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"itami-hypertrophy/internal/keys"
 )
 
 type contextKey string
 
-// ✅ SINGLE global key for user email in context
-var UserEmailKey = contextKey("userEmail")
+// ✅ SINGLE global key for the user id (users.id) in context
+var UserIDKey = contextKey("userID")
 
-func JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
-			return
+// token family (one per login) so logout can revoke it
+var TokenFamilyKey = contextKey("tokenFamily")
+
+// the Authorization header if there is one, otherwise (in cookie mode) the
+// access cookie, which only counts together with a matching csrf token
+func requestToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer "), true
+	}
+
+	if authHeader == "" && authMode() == authModeCookie {
+		if c, err := r.Cookie(accessCookie); err == nil && c.Value != "" {
+			if !checkCSRF(w, r) {
+				return "", false
+			}
+			return c.Value, true
 		}
+	}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		secret := os.Getenv("JWT_SECRET")
+	http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+	return "", false
+}
 
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+// login sessions only, personal access tokens are refused here
+func JWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString, ok := requestToken(w, r)
+		if !ok {
 			return
 		}
+		authenticateJWT(w, r, tokenString, next)
+	}
+}
 
-		email, ok := claims["email"].(string)
+// for routes scripts may call: takes a login session (full access) or a
+// personal access token that carries the given scope
+func ScopedAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString, ok := requestToken(w, r)
 		if !ok {
-			http.Error(w, "Invalid token payload", http.StatusUnauthorized)
 			return
 		}
+		if strings.HasPrefix(tokenString, patPrefix) {
+			authenticatePAT(w, r, tokenString, scope, next)
+			return
+		}
+		authenticateJWT(w, r, tokenString, next)
+	}
+}
 
-		// ✅ store email in context
-		ctx := context.WithValue(r.Context(), UserEmailKey, email)
-		next(w, r.WithContext(ctx))
+func authenticateJWT(w http.ResponseWriter, r *http.Request, tokenString string, next http.HandlerFunc) {
+	claims := jwt.MapClaims{}
+	token, err := keys.Default.Parse(tokenString, claims,
+		jwt.WithIssuer(tokenIssuer), jwt.WithAudience(accessAudience))
+	if err != nil || !token.Valid {
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
 	}
+	if typ, _ := claims["typ"].(string); typ != accessType {
+		http.Error(w, "Invalid token payload", http.StatusUnauthorized)
+		return
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := strconv.Atoi(sub)
+	if err != nil {
+		http.Error(w, "Invalid token payload", http.StatusUnauthorized)
+		return
+	}
+
+	family, ok := claims["fam"].(string)
+	if !ok || family == "" {
+		http.Error(w, "Invalid token payload", http.StatusUnauthorized)
+		return
+	}
+
+	// revoked sessions are gone from redis → token is dead even before exp
+	active, err := touchSession(family, clientIP(r))
+	if err != nil {
+		http.Error(w, "Token check failed", http.StatusInternalServerError)
+		return
+	}
+	if !active {
+		http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	if verified, _ := claims["verified"].(bool); verificationRefused(w, r, verified) {
+		return
+	}
+
+	// ✅ store user id in context
+	ctx := context.WithValue(r.Context(), UserIDKey, userID)
+	ctx = context.WithValue(ctx, TokenFamilyKey, family)
+	next(w, r.WithContext(ctx))
 }
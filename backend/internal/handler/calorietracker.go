@@ -1,17 +1,63 @@
 package handler
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/nutrition"
+	"itami-hypertrophy/internal/user"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 type calorieRequest struct {
 	Description string `json:"description"`
+	MealType    string `json:"meal_type"` // breakfast, lunch, ... see mealTypes. optional
+	// optional, straight off a label. any of them set skips the provider
+	Calories *float64 `json:"calories"`
+	Protein  *float64 `json:"protein"`
+	Carbs    *float64 `json:"carbs"`
+	Fat      *float64 `json:"fat"`
+}
+
+// upper bound for one hand-entered meal, mostly to catch typos (2500 → 25000)
+const maxManualCalories = 10000
+
+func (req calorieRequest) manual() bool {
+	return req.Calories != nil || req.Protein != nil || req.Carbs != nil || req.Fat != nil
+}
+
+// the hand-entered macros, or what's wrong with them. protein/carbs/fat
+// default to 0, calories are required
+func (req calorieRequest) manualMacros() (nutrition.Macros, string) {
+	var m nutrition.Macros
+	if req.Calories == nil {
+		return m, "calories are required when entering macros manually"
+	}
+	for _, f := range []struct {
+		src *float64
+		dst *float64
+	}{
+		{req.Calories, &m.Calories}, {req.Protein, &m.Protein}, {req.Carbs, &m.Carbs}, {req.Fat, &m.Fat},
+	} {
+		if f.src == nil {
+			continue
+		}
+		if *f.src < 0 {
+			return m, "macros can't be negative"
+		}
+		*f.dst = *f.src
+	}
+	if m.Calories > maxManualCalories {
+		return m, fmt.Sprintf("calories can't be more than %d for one meal", maxManualCalories)
+	}
+	// 4/4/9 kcal per gram. labels round and fibre muddies carbs, so leave plenty of slack
+	if fromMacros := 4*m.Protein + 4*m.Carbs + 9*m.Fat; fromMacros > m.Calories*1.25+20 {
+		return m, fmt.Sprintf("protein, carbs and fat add up to about %.0f kcal, more than the %.0f given", fromMacros, m.Calories)
+	}
+	return m, ""
 }
 
 type NutritionResult struct {
@@ -21,50 +67,35 @@ type NutritionResult struct {
 	Fat      float64
 }
 
-func fetchNutritionFromNutritionix(description string) (NutritionResult, error) {
-	appID := os.Getenv("NUTRITIONIX_APP_ID")
-	appKey := os.Getenv("NUTRITIONIX_APP_KEY")
-
-	reqBody := map[string]string{"query": description}
-	jsonData, _ := json.Marshal(reqBody)
-
-	req, err := http.NewRequest("POST", "https://trackapi.nutritionix.com/v2/natural/nutrients", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return NutritionResult{}, err
+// the foods for a meal: the hand-entered macros as one item, or whatever the
+// provider makes of the description. writes the error itself
+func mealItemsFor(w http.ResponseWriter, r *http.Request, req calorieRequest) ([]nutrition.Item, string, bool) {
+	if req.manual() {
+		// macros given, nothing to look up. stored as a single item so it can still be edited
+		macros, problem := req.manualMacros()
+		if problem != "" {
+			http.Error(w, problem, http.StatusBadRequest)
+			return nil, "", false
+		}
+		return []nutrition.Item{{Name: req.Description, Quantity: 1, Unit: "serving", Macros: macros}}, sourceManual, true
 	}
 
-	req.Header.Set("x-app-id", appID)
-	req.Header.Set("x-app-key", appKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return NutritionResult{}, err
+	// ?nocache=1 (or Cache-Control: no-cache) asks the provider again, e.g. when a cached answer looks wrong
+	ctx := r.Context()
+	if r.URL.Query().Get("nocache") == "1" || strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+		ctx = nutrition.WithoutCache(ctx)
 	}
-	defer resp.Body.Close()
 
-	var response struct {
-		Foods []struct {
-			Calories float64 `json:"nf_calories"`
-			Protein  float64 `json:"nf_protein"`
-			Carbs    float64 `json:"nf_total_carbohydrate"`
-			Fat      float64 `json:"nf_total_fat"`
-		} `json:"foods"`
-	}
-	err = json.NewDecoder(resp.Body).Decode(&response)
-	if err != nil || len(response.Foods) == 0 {
-		return NutritionResult{}, fmt.Errorf("failed to parse response")
+	items, err := nutrition.Default.Lookup(ctx, req.Description)
+	if err == nutrition.ErrNoMatch {
+		http.Error(w, "Couldn't recognise any food in that description", http.StatusUnprocessableEntity)
+		return nil, "", false
 	}
-
-	var total NutritionResult
-	for _, food := range response.Foods {
-		total.Calories += food.Calories
-		total.Protein += food.Protein
-		total.Carbs += food.Carbs
-		total.Fat += food.Fat
+	if err != nil {
+		http.Error(w, "ailed to fetch nutrition "+err.Error(), http.StatusInternalServerError)
+		return nil, "", false
 	}
-	return total, nil
+	return items, sourceEstimated, true
 }
 
 func LogCalories(w http.ResponseWriter, r *http.Request) {
@@ -79,20 +110,23 @@ func LogCalories(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
+	if req.MealType == "" {
+		req.MealType = defaultMealType
+	}
+	if !validMealType(req.MealType) {
+		http.Error(w, "Invalid meal_type", http.StatusBadRequest)
+		return
+	}
 
-	email := r.Context().Value(UserEmailKey).(string)
+	userID := r.Context().Value(UserIDKey).(int)
 
-	nutrition, err := fetchNutritionFromNutritionix(req.Description)
-	if err != nil {
-		http.Error(w, "ailed to fetch nutrition "+err.Error(), http.StatusInternalServerError)
+	items, source, ok := mealItemsFor(w, r, req)
+	if !ok {
 		return
 	}
+	total := nutrition.Sum(items)
 
-	_, err = db.DB.Exec(`
-		INSERT INTO meals (email, description, calories, protein, carbs, fat)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, email, req.Description, nutrition.Calories, nutrition.Protein, nutrition.Carbs, nutrition.Fat)
-
+	mealID, err := insertMeal(userID, req.Description, source, req.MealType, items)
 	if err != nil {
 		http.Error(w, "failed to save "+err.Error(), http.StatusInternalServerError)
 		return
@@ -100,15 +134,55 @@ func LogCalories(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"email":       email,
+		"id":          mealID,
+		"user_id":     userID,
 		"description": req.Description,
-		"calories":    nutrition.Calories,
-		"protein":     nutrition.Protein,
-		"carbs":       nutrition.Carbs,
-		"fat":         nutrition.Fat,
+		"calories":    total.Calories,
+		"protein":     total.Protein,
+		"carbs":       total.Carbs,
+		"fat":         total.Fat,
+		"source":      source,
+		"meal_type":   req.MealType,
+		"items":       items,
 	})
 }
 
+// OPERATOR_EMAILS="a@x.com,b@y.com" → the accounts allowed to see
+// server-wide numbers like the cache stats. nobody when unset
+func isOperator(userID int) bool {
+	u, err := Users.ByID(userID)
+	if err != nil || !u.EmailVerified {
+		return false
+	}
+	for _, e := range strings.Split(os.Getenv("OPERATOR_EMAILS"), ",") {
+		if e = user.NormalizeEmail(e); e != "" && e == u.Email {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /nutrition/cache-stats → how often lookups were answered from the
+// cache, across all users so operators only
+func GetNutritionCacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !isOperator(r.Context().Value(UserIDKey).(int)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	stats, err := nutrition.GetCacheStats(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to fetch cache stats", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, stats)
+}
+
 // gpt-ed coz didnt know how to use the time wala thing also sleepy
 func GetMeals(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -116,34 +190,25 @@ func GetMeals(w http.ResponseWriter, r *http.Request) {
 		return
 	} //ykwitmeans
 
-	email := r.Context().Value(UserEmailKey).(string) // jwt se user ki info nikali aur ab wahi dikhaenge jo user hai not kisi aur ka
+	userID := r.Context().Value(UserIDKey).(int) // jwt se user ki info nikali aur ab wahi dikhaenge jo user hai not kisi aur ka
 
 	rows, err := db.DB.Query(`
-		SELECT description, calories, protein, carbs, fat, created_at
+		SELECT id, description, calories, protein, carbs, fat, source, meal_type, created_at
 		FROM meals
-		WHERE email = $1
+		WHERE user_id = $1
 		ORDER BY created_at DESC
-	`, email) //db se wo uthaya jo chahiye aur usko aaj ke hisab se sort kia
+	`, userID) //db se wo uthaya jo chahiye aur usko aaj ke hisab se sort kia
 	if err != nil {
 		http.Error(w, "Failed to fetch meals: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	type Meal struct {
-		Description string  `json:"description"`
-		Calories    float64 `json:"calories"`
-		Protein     float64 `json:"protein"`
-		Carbs       float64 `json:"carbs"`
-		Fat         float64 `json:"fat"`
-		LoggedAt    string  `json:"logged_at"`
-	} //display krne ko
-
 	var meals []Meal
 	for rows.Next() {
 		var m Meal
 		var createdAt time.Time
-		err := rows.Scan(&m.Description, &m.Calories, &m.Protein, &m.Carbs, &m.Fat, &createdAt)
+		err := rows.Scan(&m.ID, &m.Description, &m.Calories, &m.Protein, &m.Carbs, &m.Fat, &m.Source, &m.MealType, &createdAt)
 		if err != nil {
 			http.Error(w, "Row scan failed", http.StatusInternalServerError)
 			return
@@ -152,6 +217,11 @@ func GetMeals(w http.ResponseWriter, r *http.Request) {
 		meals = append(meals, m)
 	}
 
+	if err := attachMealItems(meals); err != nil {
+		http.Error(w, "Failed to fetch meal items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(meals)
 }
@@ -163,41 +233,32 @@ func GetTodayMeals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Context().Value(UserEmailKey).(string)
+	userID := r.Context().Value(UserIDKey).(int)
 
-	// time uthaya
-	now := time.Now()
+	// time uthaya (in the user's own timezone)
+	now := time.Now().In(userLocation(userID))
 	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	end := start.Add(24 * time.Hour)
+	end := start.AddDate(0, 0, 1)
 
 	rows, err := db.DB.Query(`
-		SELECT description, calories, protein, carbs, fat, created_at
+		SELECT id, description, calories, protein, carbs, fat, source, meal_type, created_at
 		FROM meals
-		WHERE email = $1 AND created_at >= $2 AND created_at < $3
+		WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
 		ORDER BY created_at ASC
-	`, email, start, end)
+	`, userID, start, end)
 	if err != nil {
 		http.Error(w, "Failed to fetch meals: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	type Meal struct {
-		Description string  `json:"description"`
-		Calories    float64 `json:"calories"`
-		Protein     float64 `json:"protein"`
-		Carbs       float64 `json:"carbs"`
-		Fat         float64 `json:"fat"`
-		LoggedAt    string  `json:"logged_at"`
-	}
-
 	var meals []Meal
 	var total NutritionResult
 
 	for rows.Next() {
 		var m Meal
 		var createdAt time.Time
-		err := rows.Scan(&m.Description, &m.Calories, &m.Protein, &m.Carbs, &m.Fat, &createdAt)
+		err := rows.Scan(&m.ID, &m.Description, &m.Calories, &m.Protein, &m.Carbs, &m.Fat, &m.Source, &m.MealType, &createdAt)
 		if err != nil {
 			http.Error(w, "Row scan failed", http.StatusInternalServerError)
 			return
@@ -211,9 +272,15 @@ func GetTodayMeals(w http.ResponseWriter, r *http.Request) {
 		total.Fat += m.Fat
 	}
 
+	if err := attachMealItems(meals); err != nil {
+		http.Error(w, "Failed to fetch meal items: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"meals":   meals,
-		"summary": total,
+		"meals":       meals,
+		"meal_groups": groupMeals(meals),
+		"summary":     total,
 	})
 }
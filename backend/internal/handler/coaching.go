@@ -0,0 +1,363 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/mail"
+	"itami-hypertrophy/internal/user"
+)
+
+// set when a coach is reading an athlete's data, UserIDKey is the athlete then
+var CoachIDKey = contextKey("coachID")
+
+type CoachLink struct {
+	ID           int        `json:"id"`
+	CoachID      int        `json:"coach_id"`
+	CoachEmail   string     `json:"coach_email"`
+	AthleteID    int        `json:"athlete_id"`
+	AthleteEmail string     `json:"athlete_email"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	AcceptedAt   *time.Time `json:"accepted_at"`
+}
+
+type inviteAthleteRequest struct {
+	AthleteEmail string `json:"athlete_email"`
+}
+
+func queryLinks(where string, args ...interface{}) ([]CoachLink, error) {
+	rows, err := db.DB.Query(`
+		SELECT l.id, l.coach_id, c.email, l.athlete_id, a.email, l.status, l.created_at, l.accepted_at
+		FROM coach_links l
+		JOIN users c ON c.id = l.coach_id
+		JOIN users a ON a.id = l.athlete_id
+		WHERE `+where+`
+		ORDER BY l.created_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []CoachLink{}
+	for rows.Next() {
+		var l CoachLink
+		err := rows.Scan(&l.ID, &l.CoachID, &l.CoachEmail, &l.AthleteID, &l.AthleteEmail, &l.Status, &l.CreatedAt, &l.AcceptedAt)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// wraps the read endpoints so a coach can pass ?athlete=<id>. without the
+// param it's a no-op; with it the request runs as the athlete, read-only,
+// and lands in the athlete's access log
+func AthleteAccess(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		athleteParam := r.URL.Query().Get("athlete")
+		if athleteParam == "" {
+			next(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Coaches have read-only access", http.StatusForbidden)
+			return
+		}
+
+		coachID := r.Context().Value(UserIDKey).(int)
+		athleteID, err := strconv.Atoi(athleteParam)
+		if err != nil {
+			http.Error(w, "Invalid athlete id", http.StatusBadRequest)
+			return
+		}
+
+		var linked bool
+		err = db.DB.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM coach_links WHERE coach_id = $1 AND athlete_id = $2 AND status = 'active')
+		`, coachID, athleteID).Scan(&linked)
+		if err != nil {
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		if !linked {
+			http.Error(w, "You are not coaching this athlete", http.StatusForbidden)
+			return
+		}
+
+		res, err := db.DB.Exec(`
+			INSERT INTO coach_access_log (coach_id, coach_email, athlete_id, method, path)
+			SELECT id, email, $2, $3, $4 FROM users WHERE id = $1
+		`, coachID, athleteID, r.Method, r.URL.RequestURI())
+		if err == nil {
+			if n, _ := res.RowsAffected(); n == 0 {
+				err = user.ErrNotFound
+			}
+		}
+		if err != nil {
+			// no audit entry → no access
+			http.Error(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserIDKey, athleteID)
+		ctx = context.WithValue(ctx, CoachIDKey, coachID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// every invite mails someone, so a coach only gets so many a day
+var inviteAthlete = RateLimit(20, 24*time.Hour, InviteAthlete)
+
+// GET /coaching/invitations → pending invites sent and received,
+// POST /coaching/invitations → invite an athlete by email
+func InvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListInvitations(w, r)
+	case http.MethodPost:
+		inviteAthlete(w, r)
+	default:
+		http.Error(w, "Only GET or POST allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func ListInvitations(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDKey).(int)
+
+	received, err := queryLinks("l.athlete_id = $1 AND l.status = 'pending'", userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch invitations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sent, err := queryLinks("l.coach_id = $1 AND l.status = 'pending'", userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch invitations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"received": received,
+		"sent":     sent,
+	})
+}
+
+// answers the same whether or not the address has an account, so it can't be
+// used to find out who's registered. the invite shows up in the sent list
+// once it exists
+func InviteAthlete(w http.ResponseWriter, r *http.Request) {
+	coachID := r.Context().Value(UserIDKey).(int)
+
+	var req inviteAthleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AthleteEmail == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	athlete, err := Users.ByEmail(req.AthleteEmail)
+	if err == user.ErrNotFound {
+		writeInviteSent(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if athlete.ID == coachID {
+		http.Error(w, "You can't coach yourself", http.StatusBadRequest)
+		return
+	}
+
+	// an open link already there isn't an error either, a 409 would give the
+	// account away on the second try
+	res, err := db.DB.Exec(`
+		INSERT INTO coach_links (coach_id, athlete_id) VALUES ($1, $2)
+		ON CONFLICT (coach_id, athlete_id) WHERE status IN ('pending', 'active') DO NOTHING
+	`, coachID, athlete.ID)
+	if err != nil {
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeInviteSent(w)
+		return
+	}
+
+	coach, err := Users.ByID(coachID)
+	if err == nil {
+		err = mail.Default.Send(mail.Message{
+			To:      athlete.Email,
+			Subject: "Coaching invitation on Itami",
+			Body: coach.Email + " wants to coach you on Itami and would get read access to " +
+				"your meals, workouts, goals and dashboard.\n\n" +
+				"Accept or decline it from your account: " + appURL() + "/coaching",
+		})
+	}
+	if err != nil {
+		log.Println("invitation mail failed:", err)
+	}
+
+	writeInviteSent(w)
+}
+
+func writeInviteSent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("If that address has an account, they've been sent an invitation"))
+}
+
+// POST /coaching/invitations/{id}/accept and .../decline, athlete only
+func respondToInvitation(accept bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID := r.Context().Value(UserIDKey).(int)
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid invitation id", http.StatusBadRequest)
+			return
+		}
+
+		query := "UPDATE coach_links SET status = 'declined', ended_at = NOW()"
+		if accept {
+			query = "UPDATE coach_links SET status = 'active', accepted_at = NOW()"
+		}
+		res, err := db.DB.Exec(query+" WHERE id = $1 AND athlete_id = $2 AND status = 'pending'", id, userID)
+		if err != nil {
+			http.Error(w, "Failed to update invitation", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+
+		if accept {
+			w.Write([]byte("Invitation accepted"))
+		} else {
+			w.Write([]byte("Invitation declined"))
+		}
+	}
+}
+
+var (
+	AcceptInvitation  = respondToInvitation(true)
+	DeclineInvitation = respondToInvitation(false)
+)
+
+// GET /coaching/links → active links, as coach ("athletes") and as athlete ("coaches")
+func ListCoachLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	athletes, err := queryLinks("l.coach_id = $1 AND l.status = 'active'", userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	coaches, err := queryLinks("l.athlete_id = $1 AND l.status = 'active'", userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"athletes": athletes,
+		"coaches":  coaches,
+	})
+}
+
+// DELETE /coaching/links/{id} → either side ends the link (or the coach withdraws an invite)
+func EndCoachLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid link id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := db.DB.Exec(`
+		UPDATE coach_links SET status = 'ended', ended_at = NOW()
+		WHERE id = $1 AND (coach_id = $2 OR athlete_id = $2) AND status IN ('pending', 'active')
+	`, id, userID)
+	if err != nil {
+		http.Error(w, "Failed to end link", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Link not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /coaching/access-log → which coach looked at what of mine, newest first
+func GetCoachAccessLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	rows, err := db.DB.Query(`
+		SELECT coach_id, coach_email, method, path, accessed_at
+		FROM coach_access_log
+		WHERE athlete_id = $1
+		ORDER BY accessed_at DESC
+		LIMIT 500
+	`, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch access log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// CoachID is null once the coach has deleted their account
+	type Entry struct {
+		CoachID    *int      `json:"coach_id"`
+		CoachEmail string    `json:"coach_email"`
+		Method     string    `json:"method"`
+		Path       string    `json:"path"`
+		AccessedAt time.Time `json:"accessed_at"`
+	}
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.CoachID, &e.CoachEmail, &e.Method, &e.Path, &e.AccessedAt); err != nil {
+			http.Error(w, "Row scan failed", http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, e)
+	}
+
+	writeJSON(w, entries)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AUTH_MODE=cookie keeps tokens away from javascript: login/refresh put them
+// in HttpOnly cookies instead of the response body. cookies get sent along
+// automatically, so every state-changing request authenticated by cookie
+// also has to echo the (readable) csrf cookie in X-CSRF-Token, which another
+// site can't do. bearer headers keep working in both modes, for scripts,
+// PATs and mobile clients.
+const (
+	authModeBearer = "bearer"
+	authModeCookie = "cookie"
+
+	accessCookie  = "itami_access"
+	refreshCookie = "itami_refresh"
+	csrfCookie    = "itami_csrf"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+func authMode() string {
+	if os.Getenv("AUTH_MODE") == authModeCookie {
+		return authModeCookie
+	}
+	return authModeBearer
+}
+
+// COOKIE_SAMESITE=strict|lax|none, lax by default
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// COOKIE_SECURE=false only for plain-http setups, browsers refuse SameSite=None without it
+func cookieSecure() bool {
+	return os.Getenv("COOKIE_SECURE") != "false" || cookieSameSite() == http.SameSiteNoneMode
+}
+
+func authCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   os.Getenv("COOKIE_DOMAIN"),
+		MaxAge:   maxAge,
+		Secure:   cookieSecure(),
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(),
+	}
+}
+
+func setAuthCookies(w http.ResponseWriter, accessToken, refreshToken, csrfToken string) {
+	http.SetCookie(w, authCookie(accessCookie, accessToken, int(accessTokenTTL.Seconds()), true))
+	http.SetCookie(w, authCookie(refreshCookie, refreshToken, int(refreshTokenTTL.Seconds()), true))
+	// the frontend has to read this one to send it back in the header
+	http.SetCookie(w, authCookie(csrfCookie, csrfToken, int(refreshTokenTTL.Seconds()), false))
+}
+
+func clearAuthCookies(w http.ResponseWriter) {
+	for _, name := range []string{accessCookie, refreshCookie, csrfCookie} {
+		http.SetCookie(w, authCookie(name, "", -1, name != csrfCookie))
+	}
+}
+
+// double submit: header and cookie have to match. safe methods don't change
+// anything so they don't need it
+func checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	c, err := r.Cookie(csrfCookie)
+	header := r.Header.Get(csrfHeader)
+	if err != nil || c.Value == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(header)) != 1 {
+		http.Error(w, "Missing or invalid CSRF token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		cookie string // "" for no cookie
+		header string
+		ok     bool
+	}{
+		{"get needs nothing", http.MethodGet, "", "", true},
+		{"head needs nothing", http.MethodHead, "", "", true},
+		{"options needs nothing", http.MethodOptions, "", "", true},
+		{"matching", http.MethodPost, "tok", "tok", true},
+		{"matching delete", http.MethodDelete, "tok", "tok", true},
+		{"no header", http.MethodPost, "tok", "", false},
+		{"no cookie", http.MethodPost, "", "tok", false},
+		{"both empty", http.MethodPut, "", "", false},
+		{"mismatch", http.MethodPatch, "tok", "other", false},
+		{"prefix", http.MethodPost, "tok", "to", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/meals", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(csrfHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			if got := checkCSRF(w, r); got != tt.ok {
+				t.Fatalf("checkCSRF = %v, want %v", got, tt.ok)
+			}
+			if !tt.ok && w.Code != http.StatusForbidden {
+				t.Errorf("status %d, want 403", w.Code)
+			}
+		})
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		method    string
+		bearer    string
+		access    string
+		csrf      bool // send a matching csrf cookie + header
+		wantToken string
+		wantCode  int // when refused
+	}{
+		{"bearer", authModeBearer, http.MethodPost, "abc", "", false, "abc", 0},
+		{"bearer in cookie mode", authModeCookie, http.MethodPost, "abc", "", false, "abc", 0},
+		{"cookie ignored in bearer mode", authModeBearer, http.MethodGet, "", "abc", false, "", http.StatusUnauthorized},
+		{"cookie read", authModeCookie, http.MethodGet, "", "abc", false, "abc", 0},
+		{"cookie write with csrf", authModeCookie, http.MethodPost, "", "abc", true, "abc", 0},
+		{"cookie write without csrf", authModeCookie, http.MethodPost, "", "abc", false, "", http.StatusForbidden},
+		{"nothing", authModeCookie, http.MethodGet, "", "", false, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTH_MODE", tt.mode)
+			r := httptest.NewRequest(tt.method, "/meals", nil)
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.access != "" {
+				r.AddCookie(&http.Cookie{Name: accessCookie, Value: tt.access})
+			}
+			if tt.csrf {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "c"})
+				r.Header.Set(csrfHeader, "c")
+			}
+			w := httptest.NewRecorder()
+
+			token, ok := requestToken(w, r)
+			if tt.wantCode != 0 {
+				if ok || w.Code != tt.wantCode {
+					t.Errorf("got %q %v status %d, want refused with %d", token, ok, w.Code, tt.wantCode)
+				}
+				return
+			}
+			if !ok || token != tt.wantToken {
+				t.Errorf("got %q %v, want %q", token, ok, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestAuthCookies(t *testing.T) {
+	t.Setenv("COOKIE_SAMESITE", "")
+	t.Setenv("COOKIE_SECURE", "")
+	w := httptest.NewRecorder()
+	setAuthCookies(w, "access", "refresh", "csrf")
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	for _, name := range []string{accessCookie, refreshCookie, csrfCookie} {
+		c := cookies[name]
+		if c == nil {
+			t.Fatalf("%s not set", name)
+		}
+		if !c.Secure || c.SameSite != http.SameSiteLaxMode {
+			t.Errorf("%s: Secure %v SameSite %v, want secure and lax", name, c.Secure, c.SameSite)
+		}
+		// only the csrf token may be readable by javascript
+		if c.HttpOnly != (name != csrfCookie) {
+			t.Errorf("%s: HttpOnly = %v", name, c.HttpOnly)
+		}
+	}
+
+	// browsers drop SameSite=None cookies that aren't Secure
+	t.Setenv("COOKIE_SAMESITE", "none")
+	t.Setenv("COOKIE_SECURE", "false")
+	if !cookieSecure() {
+		t.Error("SameSite=None cookie without Secure")
+	}
+}
@@ -16,16 +16,17 @@ func GetDashboardByDate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Context().Value(UserEmailKey).(string)
+	userID := r.Context().Value(UserIDKey).(int)
 
+	loc := userLocation(userID)
 	dateStr := r.URL.Query().Get("date")
 	var targetDate time.Time
 	var err error
 
 	if dateStr == "" {
-		targetDate = time.Now()
+		targetDate = time.Now().In(loc)
 	} else {
-		targetDate, err = time.Parse("2006-01-02", dateStr)
+		targetDate, err = time.ParseInLocation("2006-01-02", dateStr, loc)
 		if err != nil {
 			http.Error(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
 			return
@@ -33,37 +34,28 @@ func GetDashboardByDate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	start := time.Date(targetDate.Year(), targetDate.Month(), targetDate.Day(), 0, 0, 0, 0, targetDate.Location())
-	end := start.Add(24 * time.Hour)
+	end := start.AddDate(0, 0, 1) // not 24h, DST days are 23 or 25
 
 	// gets meals
 	mealsRows, err := db.DB.Query(`
-		SELECT description, calories, protein, carbs, fat, created_at
+		SELECT id, description, calories, protein, carbs, fat, source, meal_type, created_at
 		FROM meals
-		WHERE email = $1 AND created_at >= $2 AND created_at < $3
+		WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
 		ORDER BY created_at ASC
-	`, email, start, end)
+	`, userID, start, end)
 	if err != nil {
 		http.Error(w, "DB error (meals): "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer mealsRows.Close()
 
-	type Meal struct {
-		Description string  `json:"description"`
-		Calories    float64 `json:"calories"`
-		Protein     float64 `json:"protein"`
-		Carbs       float64 `json:"carbs"`
-		Fat         float64 `json:"fat"`
-		LoggedAt    string  `json:"logged_at"`
-	}
-
 	var meals []Meal
 	var totalCalories, totalProtein, totalCarbs, totalFat float64
 
 	for mealsRows.Next() {
 		var m Meal
 		var createdAt time.Time
-		err := mealsRows.Scan(&m.Description, &m.Calories, &m.Protein, &m.Carbs, &m.Fat, &createdAt)
+		err := mealsRows.Scan(&m.ID, &m.Description, &m.Calories, &m.Protein, &m.Carbs, &m.Fat, &m.Source, &m.MealType, &createdAt)
 		if err != nil {
 			http.Error(w, "Row scan failed (meals)", http.StatusInternalServerError)
 			return
@@ -76,15 +68,19 @@ func GetDashboardByDate(w http.ResponseWriter, r *http.Request) {
 		totalCarbs += m.Carbs
 		totalFat += m.Fat
 	}
+	if err := attachMealItems(meals); err != nil {
+		http.Error(w, "DB error (meal items): "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// gets workouts
 
 	workoutRows, err := db.DB.Query(`
 		SELECT exercise, sets, reps, weight, created_at
 		FROM strength_workouts
-		WHERE email = $1 AND created_at >= $2 AND created_at < $3
+		WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
 		ORDER BY created_at ASC
-	`, email, start, end)
+	`, userID, start, end)
 	if err != nil {
 		http.Error(w, "DB error (workouts): "+err.Error(), http.StatusInternalServerError)
 		return
@@ -133,12 +129,35 @@ func GetDashboardByDate(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"meals":    meals,
-		"workouts": workouts,
-		"summary":  summary,
+		"meals":       meals,
+		"meal_groups": groupMeals(meals),
+		"workouts":    workouts,
+		"summary":     summary,
 	})
 }
 
+const weeklyCacheTTL = 5 * time.Minute
+
+// every weekly dashboard cached for a user goes in this set, so invalidating
+// them is a lookup instead of a SCAN over the whole keyspace
+func weeklyIndexKey(userID int) string { return fmt.Sprintf("weekly_keys:%d", userID) }
+
+func cacheWeekly(userID int, key string, data []byte) {
+	cache.Rdb.Set(cache.Ctx, key, data, weeklyCacheTTL)
+	cache.Rdb.SAdd(cache.Ctx, weeklyIndexKey(userID), key)
+	// the entries are gone by then anyway
+	cache.Rdb.Expire(cache.Ctx, weeklyIndexKey(userID), weeklyCacheTTL)
+}
+
+// any change to a user's meals makes their cached weekly dashboards stale
+func invalidateWeekly(userID int) error {
+	keys, err := cache.Rdb.SMembers(cache.Ctx, weeklyIndexKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	return cache.Rdb.Del(cache.Ctx, append(keys, weeklyIndexKey(userID))...).Err()
+}
+
 // weekly tracking
 func GetWeeklyDashboard(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -146,27 +165,28 @@ func GetWeeklyDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Context().Value(UserEmailKey).(string)
+	userID := r.Context().Value(UserIDKey).(int)
 
-	// Determine start of week (Monday)
+	// Determine start of week (profile's week_start day, Monday by default)
+	loc := userLocation(userID)
 	startStr := r.URL.Query().Get("start")
 	var weekStart time.Time
 	var err error
 
 	if startStr == "" {
-		today := time.Now()
-		offset := (int(today.Weekday()) + 6) % 7
-		weekStart = today.AddDate(0, 0, -offset)
+		today := time.Now().In(loc)
+		offset := (int(today.Weekday()) - int(userWeekStart(userID)) + 7) % 7
+		weekStart = time.Date(today.Year(), today.Month(), today.Day()-offset, 0, 0, 0, 0, loc)
 	} else {
-		weekStart, err = time.Parse("2006-01-02", startStr)
+		weekStart, err = time.ParseInLocation("2006-01-02", startStr, loc)
 		if err != nil {
 			http.Error(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
 			return
 		}
 	}
 
-	// ✅ Redis cache key for this user + week
-	cacheKey := fmt.Sprintf("weekly:%s:%s", email, weekStart.Format("2006-01-02"))
+	// ✅ Redis cache key for this user + week (+ timezone, the days depend on it)
+	cacheKey := fmt.Sprintf("weekly:%d:%s:%s", userID, loc.String(), weekStart.Format("2006-01-02"))
 
 	// 1️⃣ Try to fetch from Redis first
 	cached, _ := cache.Rdb.Get(cache.Ctx, cacheKey).Result()
@@ -188,7 +208,7 @@ func GetWeeklyDashboard(w http.ResponseWriter, r *http.Request) {
 
 	for i := 0; i < 7; i++ {
 		dayStart := weekStart.AddDate(0, 0, i)
-		dayEnd := dayStart.Add(24 * time.Hour)
+		dayEnd := dayStart.AddDate(0, 0, 1)
 		dateStr := dayStart.Format("2006-01-02")
 		days = append(days, dateStr)
 
@@ -196,8 +216,8 @@ func GetWeeklyDashboard(w http.ResponseWriter, r *http.Request) {
 		err := db.DB.QueryRow(`
             SELECT COALESCE(SUM(calories),0), COALESCE(SUM(protein),0)
             FROM meals
-            WHERE email = $1 AND created_at >= $2 AND created_at < $3
-        `, email, dayStart, dayEnd).Scan(&cal, &prot)
+            WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+        `, userID, dayStart, dayEnd).Scan(&cal, &prot)
 		if err != nil {
 			http.Error(w, "DB error (meals): "+err.Error(), http.StatusInternalServerError)
 			return
@@ -205,8 +225,8 @@ func GetWeeklyDashboard(w http.ResponseWriter, r *http.Request) {
 
 		rows, err := db.DB.Query(`
             SELECT sets, reps, weight FROM strength_workouts
-            WHERE email = $1 AND created_at >= $2 AND created_at < $3
-        `, email, dayStart, dayEnd)
+            WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+        `, userID, dayStart, dayEnd)
 		if err != nil {
 			http.Error(w, "DB error (workouts): "+err.Error(), http.StatusInternalServerError)
 			return
@@ -234,8 +254,8 @@ func GetWeeklyDashboard(w http.ResponseWriter, r *http.Request) {
 	var dailyCaloriesGoal, dailyProteinGoal, weeklyVolumeGoal float64
 	err = db.DB.QueryRow(`
         SELECT daily_calories_target, daily_protein_target, weekly_volume_target
-        FROM goals WHERE email = $1
-    `, email).Scan(&dailyCaloriesGoal, &dailyProteinGoal, &weeklyVolumeGoal)
+        FROM goals WHERE user_id = $1
+    `, userID).Scan(&dailyCaloriesGoal, &dailyProteinGoal, &weeklyVolumeGoal)
 	if err != nil {
 		dailyCaloriesGoal, dailyProteinGoal, weeklyVolumeGoal = 0, 0, 0
 	}
@@ -285,7 +305,7 @@ func GetWeeklyDashboard(w http.ResponseWriter, r *http.Request) {
 
 	// ✅ Cache this response in Redis for 5 min
 	jsonBytes, _ := json.Marshal(response)
-	cache.Rdb.Set(cache.Ctx, cacheKey, jsonBytes, 5*time.Minute)
+	cacheWeekly(userID, cacheKey, jsonBytes)
 
 	// ✅ Send to client
 	w.Header().Set("Content-Type", "application/json")
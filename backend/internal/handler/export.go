@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/nutrition"
+)
+
+// turns one row into its json value and its csv record
+type exportScanner func(rows *sql.Rows) (interface{}, []string, error)
+
+type exportTable struct {
+	name   string // file name without extension
+	query  string // takes the user id as $1
+	header []string
+	scan   exportScanner
+}
+
+func ffmt(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+var exportTables = []exportTable{
+	{
+		name: "meals",
+		query: `
+			SELECT id, description, calories, protein, carbs, fat, source, meal_type, created_at
+			FROM meals WHERE user_id = $1 ORDER BY created_at ASC`,
+		header: []string{"id", "description", "calories", "protein", "carbs", "fat", "source", "meal_type", "logged_at"},
+		scan: func(rows *sql.Rows) (interface{}, []string, error) {
+			var m struct {
+				ID          int     `json:"id"`
+				Description string  `json:"description"`
+				Calories    float64 `json:"calories"`
+				Protein     float64 `json:"protein"`
+				Carbs       float64 `json:"carbs"`
+				Fat         float64 `json:"fat"`
+				Source      string  `json:"source"`
+				MealType    string  `json:"meal_type"`
+				LoggedAt    string  `json:"logged_at"`
+			}
+			var createdAt time.Time
+			if err := rows.Scan(&m.ID, &m.Description, &m.Calories, &m.Protein, &m.Carbs, &m.Fat, &m.Source, &m.MealType, &createdAt); err != nil {
+				return nil, nil, err
+			}
+			m.LoggedAt = createdAt.Format(time.RFC3339)
+			return m, []string{strconv.Itoa(m.ID), m.Description, ffmt(m.Calories), ffmt(m.Protein), ffmt(m.Carbs), ffmt(m.Fat), m.Source, m.MealType, m.LoggedAt}, nil
+		},
+	},
+	{
+		// the foods each meal was made of, meal_id points into meals
+		name: "meal_items",
+		query: `
+			SELECT i.id, i.meal_id, i.name, i.quantity, i.unit, i.grams, i.calories, i.protein, i.carbs, i.fat
+			FROM meal_items i JOIN meals m ON m.id = i.meal_id
+			WHERE m.user_id = $1 ORDER BY m.created_at ASC, i.position, i.id`,
+		header: []string{"id", "meal_id", "name", "quantity", "unit", "grams", "calories", "protein", "carbs", "fat"},
+		scan: func(rows *sql.Rows) (interface{}, []string, error) {
+			var it struct {
+				MealID int `json:"meal_id"`
+				MealItem
+			}
+			if err := rows.Scan(&it.ID, &it.MealID, &it.Name, &it.Quantity, &it.Unit, &it.Grams, &it.Calories, &it.Protein, &it.Carbs, &it.Fat); err != nil {
+				return nil, nil, err
+			}
+			return it, []string{strconv.Itoa(it.ID), strconv.Itoa(it.MealID), it.Name, ffmt(it.Quantity), it.Unit, ffmt(it.Grams),
+				ffmt(it.Calories), ffmt(it.Protein), ffmt(it.Carbs), ffmt(it.Fat)}, nil
+		},
+	},
+	{
+		name: "workouts",
+		query: `
+			SELECT exercise, sets, reps, weight, created_at
+			FROM strength_workouts WHERE user_id = $1 ORDER BY created_at ASC`,
+		header: []string{"exercise", "sets", "reps", "weight", "logged_at"},
+		scan: func(rows *sql.Rows) (interface{}, []string, error) {
+			var wo struct {
+				Exercise string  `json:"exercise"`
+				Sets     int     `json:"sets"`
+				Reps     int     `json:"reps"`
+				Weight   float64 `json:"weight"`
+				LoggedAt string  `json:"logged_at"`
+			}
+			var createdAt time.Time
+			if err := rows.Scan(&wo.Exercise, &wo.Sets, &wo.Reps, &wo.Weight, &createdAt); err != nil {
+				return nil, nil, err
+			}
+			wo.LoggedAt = createdAt.Format(time.RFC3339)
+			return wo, []string{wo.Exercise, strconv.Itoa(wo.Sets), strconv.Itoa(wo.Reps), ffmt(wo.Weight), wo.LoggedAt}, nil
+		},
+	},
+	{
+		// macros are per serving, the ingredients below are for the whole recipe
+		name: "recipes",
+		query: `
+			SELECT id, name, servings, calories, protein, carbs, fat, created_at
+			FROM recipes WHERE user_id = $1 ORDER BY created_at ASC`,
+		header: []string{"id", "name", "servings", "calories", "protein", "carbs", "fat", "created_at"},
+		scan: func(rows *sql.Rows) (interface{}, []string, error) {
+			var rc struct {
+				ID        int     `json:"id"`
+				Name      string  `json:"name"`
+				Servings  float64 `json:"servings"`
+				Calories  float64 `json:"calories"`
+				Protein   float64 `json:"protein"`
+				Carbs     float64 `json:"carbs"`
+				Fat       float64 `json:"fat"`
+				CreatedAt string  `json:"created_at"`
+			}
+			var createdAt time.Time
+			if err := rows.Scan(&rc.ID, &rc.Name, &rc.Servings, &rc.Calories, &rc.Protein, &rc.Carbs, &rc.Fat, &createdAt); err != nil {
+				return nil, nil, err
+			}
+			rc.CreatedAt = createdAt.Format(time.RFC3339)
+			return rc, []string{strconv.Itoa(rc.ID), rc.Name, ffmt(rc.Servings), ffmt(rc.Calories), ffmt(rc.Protein),
+				ffmt(rc.Carbs), ffmt(rc.Fat), rc.CreatedAt}, nil
+		},
+	},
+	{
+		name: "recipe_ingredients",
+		query: `
+			SELECT i.recipe_id, i.name, i.quantity, i.unit, i.grams, i.calories, i.protein, i.carbs, i.fat
+			FROM recipe_ingredients i JOIN recipes rc ON rc.id = i.recipe_id
+			WHERE rc.user_id = $1 ORDER BY rc.created_at ASC, i.position, i.id`,
+		header: []string{"recipe_id", "name", "quantity", "unit", "grams", "calories", "protein", "carbs", "fat"},
+		scan: func(rows *sql.Rows) (interface{}, []string, error) {
+			var it struct {
+				RecipeID int `json:"recipe_id"`
+				nutrition.Item
+			}
+			if err := rows.Scan(&it.RecipeID, &it.Name, &it.Quantity, &it.Unit, &it.Grams, &it.Calories, &it.Protein, &it.Carbs, &it.Fat); err != nil {
+				return nil, nil, err
+			}
+			return it, []string{strconv.Itoa(it.RecipeID), it.Name, ffmt(it.Quantity), it.Unit, ffmt(it.Grams),
+				ffmt(it.Calories), ffmt(it.Protein), ffmt(it.Carbs), ffmt(it.Fat)}, nil
+		},
+	},
+	{
+		name: "goals",
+		query: `
+			SELECT daily_calories, daily_protein, weekly_workout_volume
+			FROM goals WHERE user_id = $1`,
+		header: []string{"daily_calories", "daily_protein", "weekly_workout_volume"},
+		scan: func(rows *sql.Rows) (interface{}, []string, error) {
+			var g Goals
+			if err := rows.Scan(&g.DailyCalories, &g.DailyProtein, &g.WeeklyWorkoutVolume); err != nil {
+				return nil, nil, err
+			}
+			return g, []string{strconv.Itoa(g.DailyCalories), ffmt(g.DailyProtein), strconv.Itoa(g.WeeklyWorkoutVolume)}, nil
+		},
+	},
+}
+
+// writes name.json and name.csv, one row at a time so nothing is held in memory.
+// the query runs once per file since a zip entry has to be finished before the next.
+func (t exportTable) write(zw *zip.Writer, userID int) error {
+	f, err := zw.Create(t.name + ".json")
+	if err != nil {
+		return err
+	}
+	err = t.each(userID, func(first bool, v interface{}, _ []string) error {
+		sep := ",\n"
+		if first {
+			sep = "[\n"
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(f, "%s  %s", sep, b)
+		return err
+	}, func(empty bool) error {
+		if empty {
+			_, err := f.Write([]byte("[]\n"))
+			return err
+		}
+		_, err := f.Write([]byte("\n]\n"))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err = zw.Create(t.name + ".csv")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.Write(t.header); err != nil {
+		return err
+	}
+	err = t.each(userID, func(_ bool, _ interface{}, record []string) error {
+		return cw.Write(record)
+	}, func(bool) error {
+		cw.Flush()
+		return cw.Error()
+	})
+	return err
+}
+
+func (t exportTable) each(userID int, row func(first bool, v interface{}, record []string) error, done func(empty bool) error) error {
+	rows, err := db.DB.Query(t.query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		v, record, err := t.scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := row(n == 0, v, record); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return done(n == 0)
+}
+
+func writeProfileExport(zw *zip.Writer, p Profile) error {
+	f, err := zw.Create("profile.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+
+	str := func(v *string) string {
+		if v == nil {
+			return ""
+		}
+		return *v
+	}
+	num := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return ffmt(*v)
+	}
+
+	f, err = zw.Create("profile.csv")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	cw.Write([]string{"email", "display_name", "sex", "birth_date", "height_cm", "bodyweight_kg",
+		"weight_unit", "height_unit", "timezone", "week_start"})
+	cw.Write([]string{p.Email, str(p.DisplayName), str(p.Sex), str(p.BirthDate), num(p.HeightCm), num(p.BodyweightKg),
+		p.WeightUnit, p.HeightUnit, p.Timezone, p.WeekStart})
+	cw.Flush()
+	return cw.Error()
+}
+
+// GET /account/export → zip with profile, goals, meals (and their items),
+// workouts and recipes as json + csv
+func ExportAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	profile, err := loadProfile(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	filename := fmt.Sprintf("itami-export-%s.zip", time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	zw := zip.NewWriter(w)
+
+	// headers are already sent from here on, all we can do on failure is stop
+	// and leave a truncated zip, which the client will refuse to open
+	err = writeProfileExport(zw, profile)
+	for _, t := range exportTables {
+		if err != nil {
+			break
+		}
+		err = t.write(zw, userID)
+	}
+	if err != nil {
+		log.Println("export failed for user", userID, err)
+		return
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Println("export failed for user", userID, err)
+	}
+}
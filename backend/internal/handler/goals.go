@@ -14,13 +14,13 @@ type Goals struct {
 
 // GET /goals → fetch current goals
 func GetGoals(w http.ResponseWriter, r *http.Request) {
-	email := r.Context().Value(UserEmailKey).(string)
+	userID := r.Context().Value(UserIDKey).(int)
 
 	var g Goals
 	err := db.DB.QueryRow(`
         SELECT daily_calories, daily_protein, weekly_workout_volume 
-        FROM goals WHERE email = $1
-    `, email).Scan(&g.DailyCalories, &g.DailyProtein, &g.WeeklyWorkoutVolume)
+        FROM goals WHERE user_id = $1
+    `, userID).Scan(&g.DailyCalories, &g.DailyProtein, &g.WeeklyWorkoutVolume)
 
 	if err != nil {
 		http.Error(w, "No goals found. Please set them first.", http.StatusNotFound)
@@ -32,7 +32,7 @@ func GetGoals(w http.ResponseWriter, r *http.Request) {
 
 // POST /goals/set → update or create goals
 func SetGoals(w http.ResponseWriter, r *http.Request) {
-	email := r.Context().Value(UserEmailKey).(string)
+	userID := r.Context().Value(UserIDKey).(int)
 
 	var g Goals
 	if err := json.NewDecoder(r.Body).Decode(&g); err != nil {
@@ -41,13 +41,13 @@ func SetGoals(w http.ResponseWriter, r *http.Request) {
 	}
 
 	_, err := db.DB.Exec(`
-        INSERT INTO goals (email, daily_calories, daily_protein, weekly_workout_volume)
+        INSERT INTO goals (user_id, daily_calories, daily_protein, weekly_workout_volume)
         VALUES ($1, $2, $3, $4)
-        ON CONFLICT (email) DO UPDATE SET
+        ON CONFLICT (user_id) DO UPDATE SET
         daily_calories = EXCLUDED.daily_calories,
         daily_protein = EXCLUDED.daily_protein,
         weekly_workout_volume = EXCLUDED.weekly_workout_volume
-    `, email, g.DailyCalories, g.DailyProtein, g.WeeklyWorkoutVolume)
+    `, userID, g.DailyCalories, g.DailyProtein, g.WeeklyWorkoutVolume)
 
 	if err != nil {
 		http.Error(w, "Failed to save goals: "+err.Error(), http.StatusInternalServerError)
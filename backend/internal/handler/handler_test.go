@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+
+	"itami-hypertrophy/internal/cache"
+	"itami-hypertrophy/internal/keys"
+	"itami-hypertrophy/internal/user"
+)
+
+// a throwaway signing key and in-memory users, nothing here needs postgres
+func TestMain(m *testing.M) {
+	k, err := keys.Ephemeral()
+	if err != nil {
+		panic(err)
+	}
+	keys.Default = k
+	Users = user.NewService(user.NewMemoryRepository(), user.PasswordPolicy{MinLength: 8, Cost: bcrypt.MinCost})
+	os.Exit(m.Run())
+}
+
+// tests that need redis run against TEST_REDIS_ADDR and are skipped without
+// it. keys are random per test, nothing gets flushed
+func needRedis(t *testing.T) {
+	t.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("redis at %s: %v", addr, err)
+	}
+	old := cache.Rdb
+	cache.Rdb = rdb
+	t.Cleanup(func() {
+		rdb.Close()
+		cache.Rdb = old
+	})
+}
+
+func newTestUser(t *testing.T, email string) user.User {
+	t.Helper()
+	u, err := Users.Create(email, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
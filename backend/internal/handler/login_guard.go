@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"itami-hypertrophy/internal/cache"
+	"itami-hypertrophy/internal/mail"
+	"itami-hypertrophy/internal/user"
+)
+
+// failed logins are counted per ip and per account. the first few are free,
+// after that every failure doubles the wait before the next try, and enough
+// failures on one account lock it for a while.
+const (
+	loginFreeAttempts = 3
+	loginBackoffBase  = time.Second
+	loginBackoffMax   = 15 * time.Minute
+	loginFailWindow   = time.Hour
+)
+
+// redis pub/sub channel for security events other services can listen on
+const authEventsChannel = "auth_events"
+
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+func loginMaxFailures() int { return envInt("LOGIN_MAX_FAILURES", 10) }
+
+func loginLockout() time.Duration {
+	return time.Duration(envInt("LOGIN_LOCKOUT_MINUTES", 30)) * time.Minute
+}
+
+// X-Forwarded-For is only trusted when we are told we sit behind a proxy
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY") == "true" {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// same form the accounts are stored in, so the guard's keys line up with them
+func normalizeEmail(email string) string {
+	return user.NormalizeEmail(email)
+}
+
+func failKey(kind, id string) string { return "authfail:" + kind + ":" + id }
+func waitKey(kind, id string) string { return "authwait:" + kind + ":" + id }
+func lockKey(email string) string    { return "lockout:" + email }
+
+// how long the caller still has to wait, 0 if they may try now
+func loginWait(ip, email string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{lockKey(email), waitKey("ip", ip), waitKey("acct", email)} {
+		ttl, err := cache.Rdb.PTTL(cache.Ctx, key).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+	return wait, nil
+}
+
+func backoffFor(failures int64) time.Duration {
+	if failures <= loginFreeAttempts {
+		return 0
+	}
+	d := loginBackoffBase * time.Duration(math.Pow(2, float64(failures-loginFreeAttempts-1)))
+	if d > loginBackoffMax || d <= 0 {
+		return loginBackoffMax
+	}
+	return d
+}
+
+func countFailure(kind, id string) int64 {
+	n, err := cache.Rdb.Incr(cache.Ctx, failKey(kind, id)).Result()
+	if err != nil {
+		log.Println("login guard:", err)
+		return 0
+	}
+	if n == 1 {
+		cache.Rdb.Expire(cache.Ctx, failKey(kind, id), loginFailWindow)
+	}
+	if wait := backoffFor(n); wait > 0 {
+		cache.Rdb.Set(cache.Ctx, waitKey(kind, id), 1, wait)
+	}
+	return n
+}
+
+func recordLoginFailure(ip, email string) {
+	countFailure("ip", ip)
+	n := countFailure("acct", email)
+
+	if n >= int64(loginMaxFailures()) {
+		// SETNX so the notification goes out once per lockout, not per attempt
+		locked, err := cache.Rdb.SetNX(cache.Ctx, lockKey(email), ip, loginLockout()).Result()
+		if err == nil && locked {
+			notifyLockout(email, ip)
+		}
+	}
+}
+
+// a correct password clears the account's history, the ip keeps its own
+func recordLoginSuccess(email string) {
+	cache.Rdb.Del(cache.Ctx, failKey("acct", email), waitKey("acct", email))
+}
+
+func notifyLockout(email, ip string) {
+	event, _ := json.Marshal(map[string]interface{}{
+		"type":  "auth.lockout",
+		"email": email,
+		"ip":    ip,
+		"until": time.Now().Add(loginLockout()).Format(time.RFC3339),
+	})
+	if err := cache.Rdb.Publish(cache.Ctx, authEventsChannel, event).Err(); err != nil {
+		log.Println("lockout event publish failed:", err)
+	}
+	log.Printf("account %s locked after repeated failed logins from %s", email, ip)
+
+	// the address is whatever was typed into /login, only mail people who actually
+	// have an account here, otherwise this sends mail to anyone on request
+	u, err := Users.ByEmail(email)
+	if err != nil {
+		if err != user.ErrNotFound {
+			log.Println("lockout mail lookup failed:", err)
+		}
+		return
+	}
+
+	err = mail.Default.Send(mail.Message{
+		To:      u.Email,
+		Subject: "Your Itami account was temporarily locked",
+		Body: fmt.Sprintf("We saw too many failed login attempts on your account (last one from %s), "+
+			"so logins are blocked for the next %d minutes.\n\n"+
+			"If that wasn't you, consider resetting your password: %s/forgot-password",
+			ip, int(loginLockout().Minutes()), appURL()),
+	})
+	if err != nil {
+		log.Println("lockout mail failed:", err)
+	}
+}
+
+// signups are guarded per ip the same way: a few are free, then every further
+// one within the window doubles the wait. successful or not, they all count
+func registerWait(ip string) (time.Duration, error) {
+	ttl, err := cache.Rdb.PTTL(cache.Ctx, waitKey("reg", ip)).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func recordRegisterAttempt(ip string) {
+	countFailure("reg", ip)
+}
+
+func writeTooMany(w http.ResponseWriter, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, fmt.Sprintf("Too many attempts. Try again in %d seconds", secs), http.StatusTooManyRequests)
+}
+
+// like RateLimit but keyed on the client ip, for routes without a logged in user
+func RateLimitByIP(limit int, window time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := fmt.Sprintf("rate:ip:%s:%s", clientIP(r), r.URL.Path)
+
+		count, err := cache.Rdb.Incr(cache.Ctx, key).Result()
+		if err != nil {
+			http.Error(w, "Rate limiter error", http.StatusInternalServerError)
+			return
+		}
+		if count == 1 {
+			cache.Rdb.Expire(cache.Ctx, key, window)
+		}
+
+		if int(count) > limit {
+			ttl, _ := cache.Rdb.TTL(cache.Ctx, key).Result()
+			writeTooMany(w, ttl)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,517 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/nutrition"
+)
+
+// a logged meal as the read endpoints return it
+type Meal struct {
+	ID          int        `json:"id"`
+	Description string     `json:"description"`
+	Calories    float64    `json:"calories"`
+	Protein     float64    `json:"protein"`
+	Carbs       float64    `json:"carbs"`
+	Fat         float64    `json:"fat"`
+	Source      string     `json:"source"`
+	MealType    string     `json:"meal_type"`
+	LoggedAt    string     `json:"logged_at"`
+	Items       []MealItem `json:"items"`
+}
+
+// meals.source, where the macros came from
+const (
+	sourceEstimated = "estimated" // looked up by the nutrition provider
+	sourceManual    = "manual"    // typed in by the user
+)
+
+// meals.meal_type, in the order a day's breakdown lists them
+var mealTypes = []string{"breakfast", "lunch", "dinner", "snack", "pre_workout", "post_workout", "other"}
+
+// what an untyped meal counts as
+const defaultMealType = "other"
+
+func validMealType(t string) bool {
+	for _, mt := range mealTypes {
+		if t == mt {
+			return true
+		}
+	}
+	return false
+}
+
+// one meal type of a day with its own subtotal
+type MealGroup struct {
+	MealType string           `json:"meal_type"`
+	Meals    []Meal           `json:"meals"`
+	Subtotal nutrition.Macros `json:"subtotal"`
+}
+
+// a day's meals by type, types without meals are left out
+func groupMeals(meals []Meal) []MealGroup {
+	byType := map[string]*MealGroup{}
+	for _, m := range meals {
+		g := byType[m.MealType]
+		if g == nil {
+			g = &MealGroup{MealType: m.MealType}
+			byType[m.MealType] = g
+		}
+		g.Meals = append(g.Meals, m)
+		g.Subtotal.Add(nutrition.Macros{Calories: m.Calories, Protein: m.Protein, Carbs: m.Carbs, Fat: m.Fat})
+	}
+
+	groups := []MealGroup{}
+	for _, t := range mealTypes {
+		if g := byType[t]; g != nil {
+			groups = append(groups, *g)
+		}
+	}
+	return groups
+}
+
+// one food of a logged meal. the meal row keeps the sum of its items
+type MealItem struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+	Grams    float64 `json:"grams"`
+	Calories float64 `json:"calories"`
+	Protein  float64 `json:"protein"`
+	Carbs    float64 `json:"carbs"`
+	Fat      float64 `json:"fat"`
+}
+
+// PATCH body, only what's set changes
+type mealItemUpdate struct {
+	Name     *string  `json:"name"`
+	Quantity *float64 `json:"quantity"`
+	Unit     *string  `json:"unit"`
+	Grams    *float64 `json:"grams"`
+	Calories *float64 `json:"calories"`
+	Protein  *float64 `json:"protein"`
+	Carbs    *float64 `json:"carbs"`
+	Fat      *float64 `json:"fat"`
+}
+
+// the meal and its items in one transaction, returns the new meal id
+func insertMeal(userID int, description, source, mealType string, items []nutrition.Item) (int, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	total := nutrition.Sum(items)
+	var mealID int
+	err = tx.QueryRow(`
+		INSERT INTO meals (user_id, description, calories, protein, carbs, fat, source, meal_type)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, userID, description, total.Calories, total.Protein, total.Carbs, total.Fat, source, mealType).Scan(&mealID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertMealItems(tx, mealID, items); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	invalidateWeekly(userID)
+	return mealID, nil
+}
+
+func insertMealItems(tx *sql.Tx, mealID int, items []nutrition.Item) error {
+	for i, it := range items {
+		_, err := tx.Exec(`
+			INSERT INTO meal_items (meal_id, position, name, quantity, unit, grams, calories, protein, carbs, fat)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, mealID, i, it.Name, it.Quantity, it.Unit, it.Grams, it.Calories, it.Protein, it.Carbs, it.Fat)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// one of the user's meals with its items, sql.ErrNoRows if it isn't theirs
+func loadMeal(userID, mealID int) (Meal, error) {
+	var m Meal
+	var createdAt time.Time
+	err := db.DB.QueryRow(`
+		SELECT id, description, calories, protein, carbs, fat, source, meal_type, created_at
+		FROM meals
+		WHERE id = $1 AND user_id = $2
+	`, mealID, userID).Scan(&m.ID, &m.Description, &m.Calories, &m.Protein, &m.Carbs, &m.Fat, &m.Source, &m.MealType, &createdAt)
+	if err != nil {
+		return m, err
+	}
+	m.LoggedAt = createdAt.Format(time.RFC3339)
+
+	meals := []Meal{m}
+	if err := attachMealItems(meals); err != nil {
+		return m, err
+	}
+	return meals[0], nil
+}
+
+// the meal's items become the given ones, totals follow
+func replaceMealItems(userID, mealID int, description, source, mealType string, items []nutrition.Item) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE meals SET description = $3, source = $4, meal_type = $5
+		WHERE id = $1 AND user_id = $2
+	`, mealID, userID, description, source, mealType)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// deleted in the meantime
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec("DELETE FROM meal_items WHERE meal_id = $1", mealID); err != nil {
+		return err
+	}
+	if err := insertMealItems(tx, mealID, items); err != nil {
+		return err
+	}
+	if err := recomputeMeal(tx, mealID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	invalidateWeekly(userID)
+	return nil
+}
+
+// items for a bunch of meals at once, keyed by meal id (meals without items are missing)
+func loadMealItems(mealIDs []int) (map[int][]MealItem, error) {
+	items := map[int][]MealItem{}
+	if len(mealIDs) == 0 {
+		return items, nil
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT meal_id, id, name, quantity, unit, grams, calories, protein, carbs, fat
+		FROM meal_items
+		WHERE meal_id = ANY($1)
+		ORDER BY meal_id, position, id
+	`, pq.Array(mealIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mealID int
+		var it MealItem
+		err := rows.Scan(&mealID, &it.ID, &it.Name, &it.Quantity, &it.Unit, &it.Grams, &it.Calories, &it.Protein, &it.Carbs, &it.Fat)
+		if err != nil {
+			return nil, err
+		}
+		items[mealID] = append(items[mealID], it)
+	}
+	return items, rows.Err()
+}
+
+// fills in Items for every meal with one query
+func attachMealItems(meals []Meal) error {
+	ids := make([]int, len(meals))
+	for i, m := range meals {
+		ids[i] = m.ID
+	}
+	items, err := loadMealItems(ids)
+	if err != nil {
+		return err
+	}
+	for i := range meals {
+		meals[i].Items = items[meals[i].ID]
+		if meals[i].Items == nil {
+			meals[i].Items = []MealItem{}
+		}
+	}
+	return nil
+}
+
+// sets the meal's totals back to the sum of its items
+func recomputeMeal(tx *sql.Tx, mealID int) error {
+	_, err := tx.Exec(`
+		UPDATE meals m SET
+			calories = s.calories, protein = s.protein, carbs = s.carbs, fat = s.fat
+		FROM (
+			SELECT COALESCE(SUM(calories), 0) AS calories, COALESCE(SUM(protein), 0) AS protein,
+			       COALESCE(SUM(carbs), 0) AS carbs, COALESCE(SUM(fat), 0) AS fat
+			FROM meal_items WHERE meal_id = $1
+		) s
+		WHERE m.id = $1
+	`, mealID)
+	return err
+}
+
+// changing the amount without giving new macros scales the old ones,
+// so "200g → 150g chicken" just works
+func (u mealItemUpdate) apply(it *MealItem) {
+	ratio := 0.0
+	switch {
+	case u.Quantity != nil && it.Quantity > 0:
+		ratio = *u.Quantity / it.Quantity
+	case u.Grams != nil && it.Grams > 0:
+		ratio = *u.Grams / it.Grams
+	}
+	if ratio > 0 {
+		it.Quantity *= ratio
+		it.Grams *= ratio
+		it.Calories *= ratio
+		it.Protein *= ratio
+		it.Carbs *= ratio
+		it.Fat *= ratio
+	}
+
+	for _, f := range []struct {
+		src *float64
+		dst *float64
+	}{
+		{u.Quantity, &it.Quantity}, {u.Grams, &it.Grams},
+		{u.Calories, &it.Calories}, {u.Protein, &it.Protein}, {u.Carbs, &it.Carbs}, {u.Fat, &it.Fat},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if u.Name != nil {
+		it.Name = *u.Name
+	}
+	if u.Unit != nil {
+		it.Unit = *u.Unit
+	}
+}
+
+// macros typed in by hand, as opposed to scaled from a new amount
+func (u mealItemUpdate) setsMacros() bool {
+	return u.Calories != nil || u.Protein != nil || u.Carbs != nil || u.Fat != nil
+}
+
+func (u mealItemUpdate) valid() bool {
+	if u.Name != nil && *u.Name == "" {
+		return false
+	}
+	// zero of something isn't an item, that's what DELETE is for. it would
+	// also stop apply from scaling the macros, leaving them as they were
+	if u.Quantity != nil && *u.Quantity <= 0 {
+		return false
+	}
+	for _, v := range []*float64{u.Quantity, u.Grams, u.Calories, u.Protein, u.Carbs, u.Fat} {
+		if v != nil && *v < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// PATCH /meal-items/{id} → fix one food of a meal, DELETE removes it.
+// either way the meal's totals follow, and a meal left without items is
+// deleted with its last one rather than kept around as an empty 0 kcal row
+func MealItemHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Only PATCH or DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	itemID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid item id", http.StatusBadRequest)
+		return
+	}
+
+	var update mealItemUpdate
+	if r.Method == http.MethodPatch {
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil || !update.valid() {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE so two edits of the same meal can't race each other's totals
+	var mealID int
+	var it MealItem
+	err = tx.QueryRow(`
+		SELECT i.meal_id, i.id, i.name, i.quantity, i.unit, i.grams, i.calories, i.protein, i.carbs, i.fat
+		FROM meal_items i
+		JOIN meals m ON m.id = i.meal_id
+		WHERE i.id = $1 AND m.user_id = $2
+		FOR UPDATE OF m
+	`, itemID, userID).Scan(&mealID, &it.ID, &it.Name, &it.Quantity, &it.Unit, &it.Grams, &it.Calories, &it.Protein, &it.Carbs, &it.Fat)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	mealGone := false
+	if r.Method == http.MethodDelete {
+		_, err = tx.Exec("DELETE FROM meal_items WHERE id = $1", itemID)
+		if err == nil {
+			var res sql.Result
+			res, err = tx.Exec(`
+				DELETE FROM meals WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM meal_items WHERE meal_id = $1)
+			`, mealID)
+			if err == nil {
+				n, _ := res.RowsAffected()
+				mealGone = n == 1
+			}
+		}
+	} else {
+		update.apply(&it)
+		_, err = tx.Exec(`
+			UPDATE meal_items SET name = $2, quantity = $3, unit = $4, grams = $5,
+				calories = $6, protein = $7, carbs = $8, fat = $9
+			WHERE id = $1
+		`, itemID, it.Name, it.Quantity, it.Unit, it.Grams, it.Calories, it.Protein, it.Carbs, it.Fat)
+		// the totals aren't the provider's estimate anymore
+		if err == nil && update.setsMacros() {
+			_, err = tx.Exec("UPDATE meals SET source = $2 WHERE id = $1", mealID, sourceManual)
+		}
+	}
+	if err == nil && !mealGone {
+		err = recomputeMeal(tx, mealID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to update meal", http.StatusInternalServerError)
+		return
+	}
+	invalidateWeekly(userID)
+
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, it)
+}
+
+// PUT /meals/{id} → same body as /log-calories. a new description is looked
+// up again, macros in the body replace whatever was there, meal_type is kept
+// when left out. DELETE drops the meal and its items
+func MealHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Only PUT or DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	mealID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid meal id", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		res, err := db.DB.Exec("DELETE FROM meals WHERE id = $1 AND user_id = $2", mealID, userID)
+		if err != nil {
+			http.Error(w, "Failed to delete meal", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Meal not found", http.StatusNotFound)
+			return
+		}
+		invalidateWeekly(userID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req calorieRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Description == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if req.MealType != "" && !validMealType(req.MealType) {
+		http.Error(w, "Invalid meal_type", http.StatusBadRequest)
+		return
+	}
+
+	meal, err := loadMeal(userID, mealID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Meal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	if req.MealType == "" {
+		req.MealType = meal.MealType
+	}
+
+	// same description and no macros → nothing to redo, item edits stay as they are
+	if req.Description == meal.Description && !req.manual() {
+		if req.MealType != meal.MealType {
+			_, err := db.DB.Exec("UPDATE meals SET meal_type = $3 WHERE id = $1 AND user_id = $2", mealID, userID, req.MealType)
+			if err != nil {
+				http.Error(w, "Failed to update meal", http.StatusInternalServerError)
+				return
+			}
+			meal.MealType = req.MealType
+		}
+		writeJSON(w, meal)
+		return
+	}
+
+	// the lookup happens before the transaction, no point holding the row while the provider answers
+	items, source, ok := mealItemsFor(w, r, req)
+	if !ok {
+		return
+	}
+
+	err = replaceMealItems(userID, mealID, req.Description, source, req.MealType, items)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Meal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update meal", http.StatusInternalServerError)
+		return
+	}
+
+	meal, err = loadMeal(userID, mealID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, meal)
+}
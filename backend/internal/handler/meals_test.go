@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMealItemUpdateValid(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{}`, true},
+		{`{"quantity": 150}`, true},
+		{`{"calories": 0}`, true},
+		{`{"quantity": 0}`, false},
+		{`{"quantity": -1}`, false},
+		{`{"fat": -1}`, false},
+		{`{"name": ""}`, false},
+	}
+	for _, tt := range tests {
+		var u mealItemUpdate
+		if err := json.Unmarshal([]byte(tt.body), &u); err != nil {
+			t.Fatal(err)
+		}
+		if got := u.valid(); got != tt.want {
+			t.Errorf("%s: valid = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestMealItemUpdateSetsMacros(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"quantity": 150}`, false},
+		{`{"name": "rice", "grams": 80}`, false},
+		{`{"calories": 120}`, true},
+		{`{"quantity": 150, "fat": 0}`, true},
+	}
+	for _, tt := range tests {
+		var u mealItemUpdate
+		if err := json.Unmarshal([]byte(tt.body), &u); err != nil {
+			t.Fatal(err)
+		}
+		if got := u.setsMacros(); got != tt.want {
+			t.Errorf("%s: setsMacros = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestMealItemUpdateApply(t *testing.T) {
+	item := func() MealItem {
+		return MealItem{Name: "chicken", Quantity: 200, Unit: "g", Grams: 200, Calories: 330, Protein: 62, Carbs: 0, Fat: 7.2}
+	}
+	quantity, grams, calories := 150.0, 100.0, 300.0
+
+	// a new amount scales the macros along
+	it := item()
+	mealItemUpdate{Quantity: &quantity}.apply(&it)
+	if it.Quantity != 150 || it.Grams != 150 || it.Calories != 247.5 || it.Protein != 46.5 {
+		t.Errorf("scaled by quantity: %+v", it)
+	}
+
+	it = item()
+	mealItemUpdate{Grams: &grams}.apply(&it)
+	if it.Quantity != 100 || it.Grams != 100 || it.Calories != 165 {
+		t.Errorf("scaled by grams: %+v", it)
+	}
+
+	// macros given alongside win over the scaled ones
+	it = item()
+	mealItemUpdate{Quantity: &quantity, Calories: &calories}.apply(&it)
+	if it.Calories != 300 || it.Protein != 46.5 {
+		t.Errorf("amount and calories: %+v", it)
+	}
+}
@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"itami-hypertrophy/internal/cache"
+	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/totp"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaMaxAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type disableMFARequest struct {
+	ownerProof
+	Code string `json:"code"`
+}
+
+func loadTOTP(userID int) (secret string, enabled bool, err error) {
+	var s sql.NullString
+	err = db.DB.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = $1", userID).Scan(&s, &enabled)
+	return s.String, enabled, err
+}
+
+func mfaEnabled(userID int) (bool, error) {
+	_, enabled, err := loadTOTP(userID)
+	return enabled, err
+}
+
+// turns 2fa off and forgets the secret and recovery codes
+func clearMFA(userID int) error {
+	_, err := db.DB.Exec("UPDATE users SET totp_enabled = FALSE, totp_secret = NULL WHERE id = $1", userID)
+	if err == nil {
+		_, err = db.DB.Exec("DELETE FROM totp_recovery_codes WHERE user_id = $1", userID)
+	}
+	return err
+}
+
+// recovery codes look like "k3j9-x0pq", only their sha256 is stored
+func generateRecoveryCodes(userID int) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM totp_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomToken(6)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(raw[:4] + "-" + raw[4:8])
+		_, err = tx.Exec("INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hashToken(code))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, tx.Commit()
+}
+
+func useRecoveryCode(userID int, code string) (bool, error) {
+	res, err := db.DB.Exec(`
+		UPDATE totp_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hashToken(strings.ToLower(strings.TrimSpace(code))))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// a totp code can only be used once, even inside its time window
+func useTOTPCode(userID int, secret, code string) (bool, error) {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	key := fmt.Sprintf("totp_used:%d:%d", userID, step)
+	return cache.Rdb.SetNX(cache.Ctx, key, 1, time.Duration(2*totp.Skew+1)*totp.Period).Result()
+}
+
+// accepts either a current totp code or an unused recovery code
+func checkSecondFactor(userID int, secret, code string) (bool, error) {
+	ok, err := useTOTPCode(userID, secret, code)
+	if err != nil || ok {
+		return ok, err
+	}
+	return useRecoveryCode(userID, code)
+}
+
+// for the logged in 2fa endpoints. wrong codes count against the account the
+// same way they do at /login/mfa, a stolen session shouldn't get unlimited
+// guesses either. writes the error and returns false if the code isn't good
+func checkMFACode(w http.ResponseWriter, r *http.Request, userID int, check func() (bool, error)) bool {
+	u, err := Users.ByID(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	}
+	ip, account := clientIP(r), normalizeEmail(u.Email)
+	wait, err := loginWait(ip, account)
+	if err != nil {
+		http.Error(w, "MFA check failed", http.StatusInternalServerError)
+		return false
+	}
+	if wait > 0 {
+		writeTooMany(w, wait)
+		return false
+	}
+
+	ok, err := check()
+	if err != nil {
+		http.Error(w, "MFA check failed", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		recordLoginFailure(ip, account)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// what Login sends back instead of tokens when 2fa is on
+func writeMFAChallenge(w http.ResponseWriter, userID int, device string) {
+	token, err := signTypedToken("mfa", userID, mfaChallengeTTL, jwt.MapClaims{"device": device})
+	if err != nil {
+		http.Error(w, "Could not sign token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"expires_in":   int(mfaChallengeTTL.Seconds()),
+	})
+}
+
+// POST /login/mfa → second login step, trades the challenge + code for real tokens
+func LoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req mfaLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	userID, claims, err := parseTypedToken(req.MFAToken, "mfa")
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+	jti, _ := claims["jti"].(string)
+
+	// a handful of guesses per challenge, then they have to log in again
+	attemptsKey := "mfa_attempts:" + jti
+	attempts, err := cache.Rdb.Incr(cache.Ctx, attemptsKey).Result()
+	if err != nil {
+		http.Error(w, "MFA check failed", http.StatusInternalServerError)
+		return
+	}
+	if attempts == 1 {
+		cache.Rdb.Expire(cache.Ctx, attemptsKey, mfaChallengeTTL)
+	}
+	if attempts > mfaMaxAttempts {
+		http.Error(w, "Too many attempts, please log in again", http.StatusTooManyRequests)
+		return
+	}
+
+	secret, enabled, err := loadTOTP(userID)
+	if err != nil || !enabled {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	// wrong codes count against the account like wrong passwords, otherwise
+	// fresh challenges would give unlimited guesses at the 6 digits
+	u, err := Users.ByID(userID)
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+	ip, account := clientIP(r), normalizeEmail(u.Email)
+	wait, err := loginWait(ip, account)
+	if err != nil {
+		http.Error(w, "MFA check failed", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeTooMany(w, wait)
+		return
+	}
+
+	ok, err := checkSecondFactor(userID, secret, req.Code)
+	if err != nil {
+		http.Error(w, "MFA check failed", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		recordLoginFailure(ip, account)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	// challenge tokens are single use
+	if first, _ := cache.Rdb.SetNX(cache.Ctx, "mfa_done:"+jti, 1, mfaChallengeTTL).Result(); !first {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	recordLoginSuccess(account)
+
+	device, _ := claims["device"].(string)
+	startSession(w, r, userID, device)
+}
+
+// POST /2fa/setup → new secret + otpauth uri, not active until /2fa/enable
+func SetupMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	u, err := Users.ByID(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if enabled, err := mfaEnabled(userID); err != nil || enabled {
+		http.Error(w, "2FA is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Could not create secret", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := db.DB.Exec("UPDATE users SET totp_secret = $2 WHERE id = $1", userID, secret); err != nil {
+		http.Error(w, "Failed to save secret", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": totp.URI("Itami", u.Email, secret),
+	})
+}
+
+// POST /2fa/enable → confirm the first code from the app, returns recovery codes
+func EnableMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, err := loadTOTP(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if enabled {
+		http.Error(w, "2FA is already enabled", http.StatusConflict)
+		return
+	}
+	if secret == "" {
+		http.Error(w, "Call /2fa/setup first", http.StatusBadRequest)
+		return
+	}
+
+	useCode := func() (bool, error) { return useTOTPCode(userID, secret, req.Code) }
+	if !checkMFACode(w, r, userID, useCode) {
+		return
+	}
+
+	codes, err := generateRecoveryCodes(userID)
+	if err != nil {
+		http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := db.DB.Exec("UPDATE users SET totp_enabled = TRUE WHERE id = $1", userID); err != nil {
+		http.Error(w, "Failed to enable 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// POST /2fa/disable → needs the password (or a reauth_code) and a code (or recovery code)
+func DisableMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	var req disableMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.given() || req.Code == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if !confirmOwner(w, userID, req.ownerProof) {
+		return
+	}
+
+	secret, enabled, err := loadTOTP(userID)
+	if err != nil || !enabled {
+		http.Error(w, "2FA is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	useCode := func() (bool, error) { return checkSecondFactor(userID, secret, req.Code) }
+	if !checkMFACode(w, r, userID, useCode) {
+		return
+	}
+
+	if err := clearMFA(userID); err != nil {
+		http.Error(w, "Failed to disable 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("2FA disabled"))
+}
+
+// POST /2fa/recovery-codes → throw away the old codes and issue new ones
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	var req mfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, err := loadTOTP(userID)
+	if err != nil || !enabled {
+		http.Error(w, "2FA is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	useCode := func() (bool, error) { return useTOTPCode(userID, secret, req.Code) }
+	if !checkMFACode(w, r, userID, useCode) {
+		return
+	}
+
+	codes, err := generateRecoveryCodes(userID)
+	if err != nil {
+		http.Error(w, "Failed to create recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
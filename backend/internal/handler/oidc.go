@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"itami-hypertrophy/internal/cache"
+	"itami-hypertrophy/internal/oidc"
+	"itami-hypertrophy/internal/user"
+)
+
+// "sign in with <provider>" goes:
+//  1. GET /oidc/{provider}/login → redirect to the provider (state, nonce, PKCE)
+//  2. GET /oidc/{provider}/callback → back from the provider, the user is found
+//     or created and the browser is sent to the frontend with a one-time code
+//  3. POST /login/oidc {code} → the frontend trades that code for our tokens,
+//     same response as /login (including the 2fa challenge)
+//
+// with ?reauth=1 the same round trip instead proves a logged in user is still
+// who they say they are (accounts without a password have nothing else): the
+// provider is asked for a fresh sign-in and the frontend gets a reauth_code
+// that sensitive endpoints take in place of the password
+const (
+	oidcStateTTL     = 10 * time.Minute
+	oidcLoginTTL     = time.Minute
+	oidcReauthTTL    = 5 * time.Minute
+	oidcReauthMaxAge = 5 * time.Minute // how long ago the provider sign-in may be
+)
+
+// what we need to remember between sending the user off and getting them back
+type oidcState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Device   string `json:"device"`
+	Reauth   bool   `json:"reauth"`
+}
+
+type oidcLogin struct {
+	UserID int    `json:"user_id"`
+	Device string `json:"device"`
+}
+
+type oidcLoginRequest struct {
+	Code string `json:"code"`
+}
+
+func oidcStateKey(state string) string { return "oidc_state:" + state }
+func oidcLoginKey(hash string) string  { return "oidc_login:" + hash }
+func oidcReauthKey(hash string) string { return "oidc_reauth:" + hash }
+
+func oidcRedirectURI(provider string) string {
+	return apiURL() + "/oidc/" + provider + "/callback"
+}
+
+// the callback is a browser navigation, so errors go back to the frontend too
+func oidcFail(w http.ResponseWriter, r *http.Request, reason string) {
+	http.Redirect(w, r, appURL()+"/oidc/callback?error="+url.QueryEscape(reason), http.StatusFound)
+}
+
+// GET /oidc/providers → which "sign in with" buttons to show
+func ListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type entry struct {
+		Name     string `json:"name"`
+		LoginURL string `json:"login_url"`
+	}
+	providers := []entry{}
+	for _, name := range oidc.Names() {
+		providers = append(providers, entry{Name: name, LoginURL: apiURL() + "/oidc/" + name + "/login"})
+	}
+	writeJSON(w, providers)
+}
+
+// GET /oidc/{provider}/login?device=... → off to the provider (?reauth=1, see the top)
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("provider")
+	p, ok := oidc.Providers[name]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	st := oidcState{Provider: name, Device: r.URL.Query().Get("device"), Reauth: r.URL.Query().Get("reauth") == "1"}
+	state, err := oidc.RandomString()
+	if err == nil {
+		st.Nonce, err = oidc.RandomString()
+	}
+	if err == nil {
+		st.Verifier, err = oidc.RandomString()
+	}
+	if err != nil {
+		http.Error(w, "Could not start login", http.StatusInternalServerError)
+		return
+	}
+
+	data, _ := json.Marshal(st)
+	if err := cache.Rdb.Set(cache.Ctx, oidcStateKey(state), data, oidcStateTTL).Err(); err != nil {
+		http.Error(w, "Could not start login", http.StatusInternalServerError)
+		return
+	}
+
+	var extra url.Values
+	if st.Reauth {
+		// an existing provider session isn't enough, they have to sign in again
+		extra = url.Values{"prompt": {"login"}, "max_age": {"0"}}
+	}
+	target, err := p.AuthCodeURL(r.Context(), oidcRedirectURI(name), state, st.Nonce, st.Verifier, extra)
+	if err != nil {
+		log.Printf("oidc %s: %v", name, err)
+		http.Error(w, "Provider unavailable", http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// GET /oidc/{provider}/callback?code=...&state=... → the provider sends the user back here
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("provider")
+	q := r.URL.Query()
+
+	if e := q.Get("error"); e != "" {
+		// user hit cancel, or the provider refused
+		oidcFail(w, r, e)
+		return
+	}
+
+	// GETDEL: a state is good for exactly one callback
+	data, err := cache.Rdb.GetDel(cache.Ctx, oidcStateKey(q.Get("state"))).Bytes()
+	var st oidcState
+	if err != nil || json.Unmarshal(data, &st) != nil || st.Provider != name {
+		oidcFail(w, r, "invalid_state")
+		return
+	}
+
+	p, ok := oidc.Providers[name]
+	if !ok || q.Get("code") == "" {
+		oidcFail(w, r, "invalid_request")
+		return
+	}
+
+	claims, err := p.Exchange(r.Context(), oidcRedirectURI(name), q.Get("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		log.Printf("oidc %s: %v", name, err)
+		oidcFail(w, r, "login_failed")
+		return
+	}
+
+	if st.Reauth {
+		oidcReauth(w, r, name, claims)
+		return
+	}
+
+	u, err := Users.LoginWithIdentity(name, claims.Subject, normalizeEmail(claims.Email), claims.EmailVerified)
+	if err == user.ErrEmailTaken {
+		// they'll have to log in with their password instead
+		oidcFail(w, r, "account_exists")
+		return
+	}
+	if err == user.ErrEmailRecentlyDeleted {
+		oidcFail(w, r, "account_recently_deleted")
+		return
+	}
+	if err == user.ErrIdentityEmailUnverified {
+		// nothing gets created or linked on an address the provider didn't check
+		oidcFail(w, r, "provider_email_unverified")
+		return
+	}
+	if err == user.ErrAccountUnverified {
+		// a password account nobody has verified yet, see LoginWithIdentity
+		oidcFail(w, r, "account_unverified")
+		return
+	}
+	if err == user.ErrInvalidInput || err == user.ErrInvalidEmail {
+		oidcFail(w, r, "email_required")
+		return
+	}
+	if err != nil {
+		log.Printf("oidc %s: %v", name, err)
+		oidcFail(w, r, "login_failed")
+		return
+	}
+
+	if !u.EmailVerified && verificationPolicy() == verificationBlock {
+		sendVerificationMail(u.ID, u.Email)
+		oidcFail(w, r, "email_unverified")
+		return
+	}
+
+	// the browser only ever sees a short-lived code, tokens go out over POST
+	code, err := randomToken(32)
+	if err != nil {
+		oidcFail(w, r, "login_failed")
+		return
+	}
+	login, _ := json.Marshal(oidcLogin{UserID: u.ID, Device: st.Device})
+	if err := cache.Rdb.Set(cache.Ctx, oidcLoginKey(hashToken(code)), login, oidcLoginTTL).Err(); err != nil {
+		oidcFail(w, r, "login_failed")
+		return
+	}
+
+	http.Redirect(w, r, appURL()+"/oidc/callback?code="+url.QueryEscape(code), http.StatusFound)
+}
+
+// end of a ?reauth=1 round trip. only an identity that's already linked counts,
+// nothing gets created or linked here
+func oidcReauth(w http.ResponseWriter, r *http.Request, provider string, claims *oidc.Claims) {
+	if claims.AuthTime == 0 || time.Since(time.Unix(claims.AuthTime, 0)) > oidcReauthMaxAge {
+		// the provider skipped the fresh sign-in we asked for
+		oidcFail(w, r, "reauth_failed")
+		return
+	}
+
+	u, err := Users.ByIdentity(provider, claims.Subject)
+	if err != nil {
+		oidcFail(w, r, "reauth_failed")
+		return
+	}
+
+	code, err := randomToken(32)
+	if err == nil {
+		err = cache.Rdb.Set(cache.Ctx, oidcReauthKey(hashToken(code)), u.ID, oidcReauthTTL).Err()
+	}
+	if err != nil {
+		oidcFail(w, r, "reauth_failed")
+		return
+	}
+	http.Redirect(w, r, appURL()+"/oidc/callback?reauth_code="+url.QueryEscape(code), http.StatusFound)
+}
+
+// takes a reauth code (single use) for the given user, writes the error itself
+func checkReauthCode(w http.ResponseWriter, userID int, code string) bool {
+	id, err := cache.Rdb.GetDel(cache.Ctx, oidcReauthKey(hashToken(code))).Int()
+	if err != nil || id != userID {
+		http.Error(w, "Invalid or expired reauth code", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// POST /login/oidc → trade the one-time code from the callback for tokens
+func LoginOIDC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req oidcLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	data, err := cache.Rdb.GetDel(cache.Ctx, oidcLoginKey(hashToken(req.Code))).Bytes()
+	var login oidcLogin
+	if err != nil || json.Unmarshal(data, &login) != nil {
+		http.Error(w, "Invalid or expired code", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := mfaEnabled(login.UserID)
+	if err != nil {
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		writeMFAChallenge(w, login.UserID, login.Device)
+		return
+	}
+
+	startSession(w, r, login.UserID, login.Device)
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"itami-hypertrophy/internal/cache"
+	"itami-hypertrophy/internal/mail"
+	"itami-hypertrophy/internal/user"
+)
+
+const passwordResetTTL = time.Hour
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func passwordResetKey(hash string) string { return "pwreset:" + hash }
+
+// base url of the frontend, used to build links that go out in mails
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:5173"
+}
+
+// public base url of this backend, for links that hit the api directly
+func apiURL() string {
+	if u := os.Getenv("API_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:8080"
+}
+
+// writes a 400 with the reason if the password policy said no
+func passwordRejected(w http.ResponseWriter, err error) bool {
+	var pe *user.PasswordError
+	if errors.As(err, &pe) {
+		http.Error(w, pe.Reason, http.StatusBadRequest)
+		return true
+	}
+	return false
+}
+
+// POST /password/forgot → mail a single-use reset link
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	// same answer whether or not the account exists (or anything went wrong
+	// past this point), so this can't be used to probe emails
+	const reply = "If that account exists, a reset link has been sent"
+
+	u, err := Users.ByEmail(req.Email)
+	if err != nil && err != user.ErrNotFound {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		if err := sendPasswordReset(u); err != nil {
+			log.Println("password reset mail failed:", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(reply))
+}
+
+func sendPasswordReset(u user.User) error {
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	// only the hash is stored, GETDEL on reset makes it single-use
+	err = cache.Rdb.Set(cache.Ctx, passwordResetKey(hashToken(token)), u.ID, passwordResetTTL).Err()
+	if err != nil {
+		return err
+	}
+
+	return mail.Default.Send(mail.Message{
+		To:      u.Email,
+		Subject: "Reset your Itami password",
+		Body: "Someone asked to reset the password for this account.\n\n" +
+			"Open this link within the next hour to choose a new one:\n" +
+			appURL() + "/reset-password?token=" + token + "\n\n" +
+			"If it wasn't you, just ignore this mail.",
+	})
+}
+
+// POST /password/reset → set a new password using the mailed token
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	// taken atomically so two requests can't both use the link, together with
+	// what's left of its lifetime in case the password gets turned down
+	key := passwordResetKey(hashToken(req.Token))
+	var ttl *redis.DurationCmd
+	var get *redis.StringCmd
+	cache.Rdb.TxPipelined(cache.Ctx, func(p redis.Pipeliner) error {
+		ttl = p.PTTL(cache.Ctx, key)
+		get = p.GetDel(cache.Ctx, key)
+		return nil
+	})
+	userID, err := get.Int()
+	if err != nil {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	if err := Users.SetPassword(userID, req.Password); err != nil {
+		if passwordRejected(w, err) {
+			// let them try again with something better, but not for longer
+			// than the link was good for in the first place
+			if left := ttl.Val(); left > 0 {
+				cache.Rdb.Set(cache.Ctx, key, userID, left)
+			}
+			return
+		}
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	// every step below runs even if one before it failed, a half secured
+	// account is still better than one where we gave up at the first error
+	secured := true
+
+	// whoever had the old password shouldn't keep their sessions or tokens
+	if err := revokeAllFamilies(userID); err != nil {
+		log.Println("revoking sessions after reset failed:", err)
+		secured = false
+	}
+	if err := revokeAllTokens(userID); err != nil {
+		log.Println("revoking access tokens after reset failed:", err)
+		secured = false
+	}
+
+	// the link came through the mailbox, so the address is theirs. this is also
+	// how the owner takes back an address someone else registered (see
+	// LoginWithIdentity): whoever had it before loses their provider logins and
+	// 2fa too, their sessions and tokens already went above
+	u, err := Users.ByID(userID)
+	if err != nil {
+		log.Println("loading account after reset failed:", err)
+		secured = false
+	} else if !u.EmailVerified {
+		err := Users.UnlinkIdentities(u.ID)
+		if err == nil {
+			err = clearMFA(u.ID)
+		}
+		if err != nil {
+			log.Println("removing logins and 2fa after reset failed:", err)
+			secured = false
+		} else if err := Users.ConfirmEmail(u.ID, u.Email); err != nil {
+			log.Println("confirming email after reset failed:", err)
+		}
+	}
+
+	if !secured {
+		http.Error(w, "Password has been reset, but the account could not be fully secured, request another reset link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("Password has been reset"))
+}
+
+// POST /password/change → new password for a logged in user, every other
+// session gets logged out (the one making the change stays) and personal
+// access tokens are revoked
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+	family := r.Context().Value(TokenFamilyKey).(string)
+
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	err := Users.ChangePassword(userID, req.CurrentPassword, req.NewPassword)
+	if err == user.ErrInvalidCredentials {
+		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+		return
+	}
+	if passwordRejected(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := revokeOtherFamilies(userID, family); err != nil {
+		http.Error(w, "Password changed, but other sessions could not be logged out", http.StatusInternalServerError)
+		return
+	}
+	if err := revokeAllTokens(userID); err != nil {
+		http.Error(w, "Password changed, but access tokens could not be revoked", http.StatusInternalServerError)
+		return
+	}
+
+	u, err := Users.ByID(userID)
+	if err == nil {
+		err = mail.Default.Send(mail.Message{
+			To:      u.Email,
+			Subject: "Your Itami password was changed",
+			Body: "The password for this account was just changed, all other devices were logged out " +
+				"and your access tokens were revoked.\n\n" +
+				"If that wasn't you, reset your password right away: " + appURL() + "/forgot-password",
+		})
+	}
+	if err != nil {
+		log.Println("password change mail failed:", err)
+	}
+
+	w.Write([]byte("Password changed"))
+}
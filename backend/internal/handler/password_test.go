@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"itami-hypertrophy/internal/cache"
+)
+
+// a rejected password gives the link back, but no more time than it had left
+func TestResetWeakPasswordKeepsTTL(t *testing.T) {
+	needRedis(t)
+	u := newTestUser(t, "reset@example.com")
+
+	token, err := randomToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := passwordResetKey(hashToken(token))
+	if err := cache.Rdb.Set(cache.Ctx, key, u.ID, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Rdb.Del(cache.Ctx, key) })
+
+	body, _ := json.Marshal(resetPasswordRequest{Token: token, Password: "short"})
+	w := httptest.NewRecorder()
+	ResetPassword(w, httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(string(body))))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("weak password: status %d, want 400", w.Code)
+	}
+
+	left, err := cache.Rdb.PTTL(cache.Ctx, key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left <= 0 || left > time.Minute {
+		t.Errorf("link has %s left after the retry, want at most the minute it had", left)
+	}
+}
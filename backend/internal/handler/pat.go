@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"itami-hypertrophy/internal/db"
+)
+
+// personal access tokens look like "itp_<random>" so the middleware can tell
+// them apart from jwts without trying to parse them
+const patPrefix = "itp_"
+
+var patScopes = map[string]bool{
+	"meals:read":     true,
+	"meals:write":    true,
+	"workouts:read":  true,
+	"workouts:write": true,
+	"dashboard:read": true,
+	"goals:read":     true,
+	"goals:write":    true,
+}
+
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+type createTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 = never
+}
+
+func authenticatePAT(w http.ResponseWriter, r *http.Request, tokenString, scope string, next http.HandlerFunc) {
+	var userID int
+	var scopes []string
+	var verified bool
+	err := db.DB.QueryRow(`
+		UPDATE personal_access_tokens t SET last_used_at = NOW()
+		FROM users u
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > NOW())
+		  AND u.id = t.user_id
+		RETURNING t.user_id, t.scopes, u.email_verified
+	`, hashToken(tokenString)).Scan(&userID, pq.Array(&scopes), &verified)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	if !hasScope(scopes, scope) {
+		http.Error(w, "Token is missing the "+scope+" scope", http.StatusForbidden)
+		return
+	}
+	if verificationRefused(w, r, verified) {
+		return
+	}
+
+	next(w, r.WithContext(context.WithValue(r.Context(), UserIDKey, userID)))
+}
+
+// every token the user has, e.g. after a password change a leaked token
+// shouldn't outlive the password it was made with
+func revokeAllTokens(userID int) error {
+	_, err := db.DB.Exec(`
+		UPDATE personal_access_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /tokens → list, POST /tokens → create
+func TokensHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListTokens(w, r)
+	case http.MethodPost:
+		CreateToken(w, r)
+	default:
+		http.Error(w, "Only GET or POST allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDKey).(int)
+
+	rows, err := db.DB.Query(`
+		SELECT id, name, scopes, created_at, last_used_at, expires_at
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch tokens: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		var t PersonalAccessToken
+		err := rows.Scan(&t.ID, &t.Name, pq.Array(&t.Scopes), &t.CreatedAt, &t.LastUsedAt, &t.ExpiresAt)
+		if err != nil {
+			http.Error(w, "Row scan failed", http.StatusInternalServerError)
+			return
+		}
+		tokens = append(tokens, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// the raw token is only ever shown in this response
+func CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDKey).(int)
+
+	var req createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" || len(req.Scopes) == 0 || req.ExpiresInDays < 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	for _, s := range req.Scopes {
+		if !patScopes[s] {
+			http.Error(w, "Unknown scope: "+s, http.StatusBadRequest)
+			return
+		}
+	}
+
+	raw, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Could not create token", http.StatusInternalServerError)
+		return
+	}
+	token := patPrefix + raw
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	t := PersonalAccessToken{Name: req.Name, Scopes: req.Scopes, ExpiresAt: expiresAt}
+	err = db.DB.QueryRow(`
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, userID, req.Name, hashToken(token), pq.Array(req.Scopes), expiresAt).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		http.Error(w, "Failed to save token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":   token,
+		"details": t,
+	})
+}
+
+// DELETE /tokens/{id}
+func RevokeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid token id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := db.DB.Exec(`
+		UPDATE personal_access_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"itami-hypertrophy/internal/db"
+)
+
+type Profile struct {
+	Email        string   `json:"email"`
+	DisplayName  *string  `json:"display_name"`
+	Sex          *string  `json:"sex"`
+	BirthDate    *string  `json:"birth_date"` // YYYY-MM-DD
+	HeightCm     *float64 `json:"height_cm"`
+	BodyweightKg *float64 `json:"bodyweight_kg"`
+	WeightUnit   string   `json:"weight_unit"` // kg | lb
+	HeightUnit   string   `json:"height_unit"` // cm | in
+	Timezone     string   `json:"timezone"`    // IANA name, e.g. Asia/Kolkata
+	WeekStart    string   `json:"week_start"`  // monday ... sunday
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// users without a profile row get the same defaults as the table
+func loadProfile(userID int) (Profile, error) {
+	p := Profile{WeightUnit: "kg", HeightUnit: "cm", Timezone: "UTC", WeekStart: "monday"}
+
+	var weightUnit, heightUnit, timezone, weekStart sql.NullString
+	err := db.DB.QueryRow(`
+		SELECT u.email, p.display_name, p.sex, to_char(p.birth_date, 'YYYY-MM-DD'),
+		       p.height_cm, p.bodyweight_kg, p.weight_unit, p.height_unit, p.timezone, p.week_start
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id = $1
+	`, userID).Scan(&p.Email, &p.DisplayName, &p.Sex, &p.BirthDate,
+		&p.HeightCm, &p.BodyweightKg, &weightUnit, &heightUnit, &timezone, &weekStart)
+	if err != nil {
+		return p, err
+	}
+
+	if weightUnit.Valid {
+		p.WeightUnit = weightUnit.String
+		p.HeightUnit = heightUnit.String
+		p.Timezone = timezone.String
+		p.WeekStart = weekStart.String
+	}
+	return p, nil
+}
+
+func (p Profile) validate() string {
+	if p.Sex != nil && *p.Sex != "male" && *p.Sex != "female" && *p.Sex != "other" {
+		return "sex must be male, female or other"
+	}
+	if p.BirthDate != nil {
+		d, err := time.Parse("2006-01-02", *p.BirthDate)
+		if err != nil || d.After(time.Now()) {
+			return "birth_date must be a past date in YYYY-MM-DD"
+		}
+	}
+	if p.HeightCm != nil && *p.HeightCm <= 0 {
+		return "height_cm must be positive"
+	}
+	if p.BodyweightKg != nil && *p.BodyweightKg <= 0 {
+		return "bodyweight_kg must be positive"
+	}
+	if p.WeightUnit != "kg" && p.WeightUnit != "lb" {
+		return "weight_unit must be kg or lb"
+	}
+	if p.HeightUnit != "cm" && p.HeightUnit != "in" {
+		return "height_unit must be cm or in"
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "" {
+		return "timezone must be an IANA name like Europe/Berlin"
+	}
+	if _, ok := weekdays[p.WeekStart]; !ok {
+		return "week_start must be a day name like monday"
+	}
+	return ""
+}
+
+// the user's timezone, falls back to server local time if anything is off
+func userLocation(userID int) *time.Location {
+	p, err := loadProfile(userID)
+	if err != nil {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+func userWeekStart(userID int) time.Weekday {
+	p, err := loadProfile(userID)
+	if err != nil {
+		return time.Monday
+	}
+	return weekdays[p.WeekStart]
+}
+
+// GET /profile → fetch, PUT /profile → replace
+func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetProfile(w, r)
+	case http.MethodPut:
+		UpdateProfile(w, r)
+	default:
+		http.Error(w, "Only GET or PUT allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDKey).(int)
+
+	p, err := loadProfile(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserIDKey).(int)
+
+	p := Profile{WeightUnit: "kg", HeightUnit: "cm", Timezone: "UTC", WeekStart: "monday"}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	p.WeekStart = strings.ToLower(p.WeekStart)
+
+	if msg := p.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	_, err := db.DB.Exec(`
+		INSERT INTO profiles (user_id, display_name, sex, birth_date, height_cm, bodyweight_kg,
+		                      weight_unit, height_unit, timezone, week_start, updated_at)
+		VALUES ($1, $2, $3, $4::date, $5, $6, $7, $8, $9, $10, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+		display_name = EXCLUDED.display_name,
+		sex = EXCLUDED.sex,
+		birth_date = EXCLUDED.birth_date,
+		height_cm = EXCLUDED.height_cm,
+		bodyweight_kg = EXCLUDED.bodyweight_kg,
+		weight_unit = EXCLUDED.weight_unit,
+		height_unit = EXCLUDED.height_unit,
+		timezone = EXCLUDED.timezone,
+		week_start = EXCLUDED.week_start,
+		updated_at = NOW()
+	`, userID, p.DisplayName, p.Sex, p.BirthDate, p.HeightCm, p.BodyweightKg,
+		p.WeightUnit, p.HeightUnit, p.Timezone, p.WeekStart)
+	if err != nil {
+		http.Error(w, "Failed to save profile: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// cached weeks were cut with the old timezone / week start
+	invalidateWeekly(userID)
+
+	GetProfile(w, r)
+}
@@ -10,15 +10,15 @@ import (
 
 func RateLimit(limit int, window time.Duration, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// ✅ fetch email from JWT context
-		email, ok := r.Context().Value(UserEmailKey).(string)
-		if !ok || email == "" {
-			http.Error(w, "Unauthorized (no email in context)", http.StatusUnauthorized)
+		// ✅ fetch user id from JWT context
+		userID, ok := r.Context().Value(UserIDKey).(int)
+		if !ok {
+			http.Error(w, "Unauthorized (no user in context)", http.StatusUnauthorized)
 			return
 		}
 
 		route := r.URL.Path
-		key := fmt.Sprintf("rate:%s:%s", email, route)
+		key := fmt.Sprintf("rate:%d:%s", userID, route)
 
 		// Redis increment
 		count, err := cache.Rdb.Incr(cache.Ctx, key).Result()
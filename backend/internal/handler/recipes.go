@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/nutrition"
+)
+
+// a saved meal. the ingredients are for the whole recipe, PerServing is what
+// one serving (of Servings) comes to
+type Recipe struct {
+	ID          int              `json:"id"`
+	Name        string           `json:"name"`
+	Servings    float64          `json:"servings"`
+	PerServing  nutrition.Macros `json:"per_serving"`
+	Ingredients []nutrition.Item `json:"ingredients"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+type createRecipeRequest struct {
+	Name        string   `json:"name"`
+	Servings    float64  `json:"servings"`    // what the ingredients make, 1 if left out
+	Ingredients []string `json:"ingredients"` // one per line, "200g chicken breast", "1 cup rice"
+}
+
+const (
+	maxRecipeIngredients = 50
+	maxServings          = 100
+)
+
+// ingredients for a bunch of recipes at once, keyed by recipe id
+func loadRecipeIngredients(recipeIDs []int) (map[int][]nutrition.Item, error) {
+	ingredients := map[int][]nutrition.Item{}
+	if len(recipeIDs) == 0 {
+		return ingredients, nil
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT recipe_id, name, quantity, unit, grams, calories, protein, carbs, fat
+		FROM recipe_ingredients
+		WHERE recipe_id = ANY($1)
+		ORDER BY recipe_id, position, id
+	`, pq.Array(recipeIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var recipeID int
+		var it nutrition.Item
+		err := rows.Scan(&recipeID, &it.Name, &it.Quantity, &it.Unit, &it.Grams, &it.Calories, &it.Protein, &it.Carbs, &it.Fat)
+		if err != nil {
+			return nil, err
+		}
+		ingredients[recipeID] = append(ingredients[recipeID], it)
+	}
+	return ingredients, rows.Err()
+}
+
+// the user's recipes (all of them when recipeID is 0), with ingredients
+func loadRecipes(userID, recipeID int) ([]Recipe, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, name, servings, calories, protein, carbs, fat, created_at
+		FROM recipes
+		WHERE user_id = $1 AND ($2 = 0 OR id = $2)
+		ORDER BY name, id
+	`, userID, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipes := []Recipe{}
+	var ids []int
+	for rows.Next() {
+		var rc Recipe
+		err := rows.Scan(&rc.ID, &rc.Name, &rc.Servings, &rc.PerServing.Calories, &rc.PerServing.Protein,
+			&rc.PerServing.Carbs, &rc.PerServing.Fat, &rc.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, rc)
+		ids = append(ids, rc.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ingredients, err := loadRecipeIngredients(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recipes {
+		recipes[i].Ingredients = ingredients[recipes[i].ID]
+		if recipes[i].Ingredients == nil {
+			recipes[i].Ingredients = []nutrition.Item{}
+		}
+	}
+	return recipes, nil
+}
+
+// one recipe, sql.ErrNoRows if it isn't the user's
+func loadRecipe(userID, recipeID int) (Recipe, error) {
+	recipes, err := loadRecipes(userID, recipeID)
+	if err != nil {
+		return Recipe{}, err
+	}
+	if len(recipes) == 0 {
+		return Recipe{}, sql.ErrNoRows
+	}
+	return recipes[0], nil
+}
+
+// GET /recipes → the user's saved recipes
+func ListRecipes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	recipes, err := loadRecipes(userID, 0)
+	if err != nil {
+		http.Error(w, "Failed to fetch recipes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, recipes)
+}
+
+// POST /recipes → looks every ingredient up once and saves the result, so
+// logging the recipe later never hits the provider again
+func CreateRecipe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	var req createRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if req.Servings == 0 {
+		req.Servings = 1
+	}
+	if req.Servings < 0 || req.Servings > maxServings {
+		http.Error(w, fmt.Sprintf("servings must be between 0 and %d", maxServings), http.StatusBadRequest)
+		return
+	}
+
+	var lines []string
+	for _, line := range req.Ingredients {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 || len(lines) > maxRecipeIngredients {
+		http.Error(w, fmt.Sprintf("a recipe needs between 1 and %d ingredients", maxRecipeIngredients), http.StatusBadRequest)
+		return
+	}
+
+	// line by line, so an unknown ingredient can be named in the error
+	var items []nutrition.Item
+	for _, line := range lines {
+		found, err := nutrition.Default.Lookup(r.Context(), line)
+		if err == nutrition.ErrNoMatch {
+			http.Error(w, fmt.Sprintf("Couldn't recognise any food in %q", line), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to fetch nutrition: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items = append(items, found...)
+	}
+	perServing := nutrition.Sum(items).Scale(1 / req.Servings)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var recipeID int
+	err = tx.QueryRow(`
+		INSERT INTO recipes (user_id, name, servings, calories, protein, carbs, fat)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, userID, strings.TrimSpace(req.Name), req.Servings, perServing.Calories, perServing.Protein, perServing.Carbs, perServing.Fat).Scan(&recipeID)
+	if err == nil {
+		for i, it := range items {
+			_, err = tx.Exec(`
+				INSERT INTO recipe_ingredients (recipe_id, position, name, quantity, unit, grams, calories, protein, carbs, fat)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			`, recipeID, i, it.Name, it.Quantity, it.Unit, it.Grams, it.Calories, it.Protein, it.Carbs, it.Fat)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to save recipe: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recipe, err := loadRecipe(userID, recipeID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recipe)
+}
+
+func recipeID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid recipe id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// GET /recipes/{id}
+func GetRecipe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+	id, ok := recipeID(w, r)
+	if !ok {
+		return
+	}
+
+	recipe, err := loadRecipe(userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, recipe)
+}
+
+// DELETE /recipes/{id} → meals already logged from it stay
+func DeleteRecipe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+	id, ok := recipeID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := db.DB.Exec("DELETE FROM recipes WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		http.Error(w, "Failed to delete recipe", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// "Overnight oats (1.5 servings)"
+func recipeMealDescription(name string, servings float64) string {
+	if servings == 1 {
+		return name + " (1 serving)"
+	}
+	return fmt.Sprintf("%s (%s servings)", name, strconv.FormatFloat(servings, 'f', -1, 64))
+}
+
+// POST /recipes/{id}/log?servings=1.5&meal_type=lunch → logs the recipe as a
+// meal, ingredients scaled to the servings eaten. no provider call
+func LogRecipe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+	id, ok := recipeID(w, r)
+	if !ok {
+		return
+	}
+
+	servings := 1.0
+	if s := r.URL.Query().Get("servings"); s != "" {
+		var err error
+		servings, err = strconv.ParseFloat(s, 64)
+		// written so NaN (which ParseFloat accepts) fails it too
+		if err != nil || !(servings > 0 && servings <= maxServings) {
+			http.Error(w, fmt.Sprintf("servings must be a number between 0 and %d", maxServings), http.StatusBadRequest)
+			return
+		}
+	}
+
+	mealType := r.URL.Query().Get("meal_type")
+	if mealType == "" {
+		mealType = defaultMealType
+	}
+	if !validMealType(mealType) {
+		http.Error(w, "Invalid meal_type", http.StatusBadRequest)
+		return
+	}
+
+	recipe, err := loadRecipe(userID, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	scale := servings / recipe.Servings
+	items := make([]nutrition.Item, len(recipe.Ingredients))
+	for i, it := range recipe.Ingredients {
+		items[i] = it.Scale(scale)
+	}
+
+	// the ingredients came from the provider when the recipe was saved
+	mealID, err := insertMeal(userID, recipeMealDescription(recipe.Name, servings), sourceEstimated, mealType, items)
+	if err != nil {
+		http.Error(w, "failed to save "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	meal, err := loadMeal(userID, mealID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(meal)
+}
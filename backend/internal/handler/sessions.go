@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"itami-hypertrophy/internal/cache"
+)
+
+// a session is one token family (see tokens.go): it starts at login, lives
+// on through refreshes, and is the thing logout/revoke deletes. its metadata
+// sits in the refresh_family:<id> hash, so "exists" still means "active".
+type Session struct {
+	ID        string `json:"id"`
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	CreatedAt string `json:"created_at"`
+	LastSeen  string `json:"last_seen"`
+	Current   bool   `json:"current"`
+}
+
+// bumps last_seen only if the session still exists, in one step so a
+// concurrent revoke can't be undone by recreating half the hash
+var touchSessionScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('HSET', KEYS[1], 'last_seen', ARGV[1], 'ip', ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// "iPhone app" if the client told us, otherwise a rough guess from the user agent
+func deviceLabel(r *http.Request, device string) string {
+	if device != "" {
+		return device
+	}
+
+	ua := r.UserAgent()
+	for _, d := range []struct{ needle, label string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Macintosh", "Mac"},
+		{"Linux", "Linux"},
+		{"curl", "curl"},
+	} {
+		if strings.Contains(ua, d.needle) {
+			return d.label
+		}
+	}
+	return "Unknown device"
+}
+
+// new family + its metadata, then the first token pair
+func startSession(w http.ResponseWriter, r *http.Request, userID int, device string) {
+	family, err := randomToken(16)
+	if err != nil {
+		http.Error(w, "Could not start session", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	err = cache.Rdb.HSet(cache.Ctx, familyKey(family), map[string]interface{}{
+		"user_id":    userID,
+		"device":     deviceLabel(r, device),
+		"user_agent": r.UserAgent(),
+		"ip":         clientIP(r),
+		"created_at": now,
+		"last_seen":  now,
+	}).Err()
+	if err != nil {
+		http.Error(w, "Could not start session", http.StatusInternalServerError)
+		return
+	}
+	cache.Rdb.Expire(cache.Ctx, familyKey(family), refreshTokenTTL)
+	cache.Rdb.SAdd(cache.Ctx, userFamiliesKey(userID), family)
+	cache.Rdb.Expire(cache.Ctx, userFamiliesKey(userID), refreshTokenTTL)
+
+	writeTokenPair(w, userID, family)
+}
+
+func touchSession(family, ip string) (bool, error) {
+	n, err := touchSessionScript.Run(cache.Ctx, cache.Rdb, []string{familyKey(family)},
+		time.Now().UTC().Format(time.RFC3339), ip).Int()
+	return n == 1, err
+}
+
+func listSessions(userID int) ([]Session, error) {
+	families, err := cache.Rdb.SMembers(cache.Ctx, userFamiliesKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, family := range families {
+		fields, err := cache.Rdb.HGetAll(cache.Ctx, familyKey(family)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 || fields["user_id"] != strconv.Itoa(userID) {
+			// expired or revoked, tidy the index while we're here
+			cache.Rdb.SRem(cache.Ctx, userFamiliesKey(userID), family)
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:        family,
+			Device:    fields["device"],
+			UserAgent: fields["user_agent"],
+			IP:        fields["ip"],
+			CreatedAt: fields["created_at"],
+			LastSeen:  fields["last_seen"],
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeen > sessions[j].LastSeen })
+	return sessions, nil
+}
+
+// GET /sessions → where the user is logged in
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+	current := r.Context().Value(TokenFamilyKey).(string)
+
+	sessions, err := listSessions(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	writeJSON(w, sessions)
+}
+
+// DELETE /sessions/{id} → log that device out
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+	family := r.PathValue("id")
+
+	owner, err := cache.Rdb.HGet(cache.Ctx, familyKey(family), "user_id").Result()
+	if err != nil && err != redis.Nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if err == redis.Nil || owner != strconv.Itoa(userID) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := revokeFamily(family); err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
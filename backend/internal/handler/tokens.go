@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+
+	"itami-hypertrophy/internal/cache"
+	"itami-hypertrophy/internal/keys"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// every token we sign says it's ours and who it's for. access tokens are for
+// the api, typed tokens get an audience of their own per typ, so none of them
+// passes for another even if a check on typ or fam were forgotten
+const (
+	tokenIssuer    = "itami"
+	accessAudience = "itami:api"
+	accessType     = "access"
+)
+
+func typedAudience(typ string) string { return "itami:" + typ }
+
+// every login starts a new token "family". refresh rotates tokens inside the
+// family, logout (or reuse of an old refresh token) kills the whole family.
+type refreshRecord struct {
+	UserID int    `json:"user_id"`
+	Family string `json:"family"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func refreshKey(hash string) string     { return "refresh:" + hash }
+func refreshUsedKey(hash string) string { return "refresh_used:" + hash }
+func familyKey(family string) string    { return "refresh_family:" + family }
+func userFamiliesKey(userID int) string { return "user_families:" + strconv.Itoa(userID) }
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func signAccessToken(userID int, family string, verified bool) (string, error) {
+	now := time.Now()
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	return keys.Default.Sign(jwt.MapClaims{
+		"iss":      tokenIssuer,
+		"aud":      accessAudience,
+		"typ":      accessType,
+		"sub":      strconv.Itoa(userID),
+		"fam":      family,
+		"verified": verified,
+		"jti":      jti,
+		"iat":      now.Unix(),
+		"exp":      now.Add(accessTokenTTL).Unix(),
+	})
+}
+
+// short-lived single purpose tokens (email verification, mfa challenge, ...).
+// typ and aud keep one kind from being accepted where another is expected,
+// JWTMiddleware only takes the access audience.
+func signTypedToken(typ string, userID int, ttl time.Duration, extra jwt.MapClaims) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	// after extra, so it can't override them
+	claims["iss"] = tokenIssuer
+	claims["aud"] = typedAudience(typ)
+	claims["sub"] = strconv.Itoa(userID)
+	claims["typ"] = typ
+	claims["jti"] = jti
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	return keys.Default.Sign(claims)
+}
+
+func parseTypedToken(tokenString, typ string) (int, jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := keys.Default.Parse(tokenString, claims,
+		jwt.WithIssuer(tokenIssuer), jwt.WithAudience(typedAudience(typ)))
+	if err != nil || !token.Valid {
+		return 0, nil, errors.New("invalid or expired token")
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := strconv.Atoi(sub)
+	if t, _ := claims["typ"].(string); t != typ || err != nil {
+		return 0, nil, errors.New("invalid token payload")
+	}
+	return userID, claims, nil
+}
+
+// stores only the sha256 of the refresh token, the raw value goes to the client
+func storeRefreshToken(userID int, family string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	rec, _ := json.Marshal(refreshRecord{UserID: userID, Family: family})
+	if err := cache.Rdb.Set(cache.Ctx, refreshKey(hashToken(token)), rec, refreshTokenTTL).Err(); err != nil {
+		return "", err
+	}
+	// every refresh keeps the session (and the user's session index) alive
+	cache.Rdb.Expire(cache.Ctx, familyKey(family), refreshTokenTTL)
+	cache.Rdb.Expire(cache.Ctx, userFamiliesKey(userID), refreshTokenTTL)
+	return token, nil
+}
+
+// kills the session and takes it out of its owner's session index
+func revokeFamily(family string) error {
+	owner, err := cache.Rdb.HGet(cache.Ctx, familyKey(family), "user_id").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err := cache.Rdb.Del(cache.Ctx, familyKey(family)).Err(); err != nil {
+		return err
+	}
+	if userID, err := strconv.Atoi(owner); err == nil {
+		return cache.Rdb.SRem(cache.Ctx, userFamiliesKey(userID), family).Err()
+	}
+	return nil
+}
+
+// logs the user out everywhere
+func revokeAllFamilies(userID int) error {
+	families, err := cache.Rdb.SMembers(cache.Ctx, userFamiliesKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if err := revokeFamily(family); err != nil {
+			return err
+		}
+	}
+	return cache.Rdb.Del(cache.Ctx, userFamiliesKey(userID)).Err()
+}
+
+// everything but keep, e.g. the session that just changed the password
+func revokeOtherFamilies(userID int, keep string) error {
+	families, err := cache.Rdb.SMembers(cache.Ctx, userFamiliesKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if family == keep {
+			continue
+		}
+		if err := revokeFamily(family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func familyActive(family string) (bool, error) {
+	n, err := cache.Rdb.Exists(cache.Ctx, familyKey(family)).Result()
+	return n == 1, err
+}
+
+// signs an access token + refresh token pair for the family and writes it out
+func writeTokenPair(w http.ResponseWriter, userID int, family string) {
+	// re-read on every refresh so verifying shows up without a new login
+	verified, err := isVerified(userID)
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := signAccessToken(userID, family, verified)
+	if err != nil {
+		http.Error(w, "Could not sign token", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := storeRefreshToken(userID, family)
+	if err != nil {
+		http.Error(w, "Could not store refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	if authMode() == authModeCookie {
+		csrfToken, err := randomToken(32)
+		if err != nil {
+			http.Error(w, "Could not create CSRF token", http.StatusInternalServerError)
+			return
+		}
+		setAuthCookies(w, accessToken, refreshToken, csrfToken)
+
+		// tokens stay in the cookies, the body only says how long they last
+		writeJSON(w, map[string]interface{}{
+			"csrf_token": csrfToken,
+			"expires_in": int(accessTokenTTL.Seconds()),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL.Seconds()),
+	})
+}
+
+// POST /token/refresh → swap a refresh token for a new pair
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// cookie clients send an empty body, the token comes from their cookie
+	var req refreshRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	if req.RefreshToken == "" && authMode() == authModeCookie {
+		if c, err := r.Cookie(refreshCookie); err == nil {
+			if !checkCSRF(w, r) {
+				return
+			}
+			req.RefreshToken = c.Value
+		}
+	}
+	if req.RefreshToken == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	hash := hashToken(req.RefreshToken)
+	raw, err := cache.Rdb.GetDel(cache.Ctx, refreshKey(hash)).Result()
+	if err != nil {
+		// token was already rotated once → someone is replaying it, kill the family
+		if family, _ := cache.Rdb.Get(cache.Ctx, refreshUsedKey(hash)).Result(); family != "" {
+			revokeFamily(family)
+		}
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	var rec refreshRecord
+	if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	active, err := familyActive(rec.Family)
+	if err != nil {
+		http.Error(w, "Token check failed", http.StatusInternalServerError)
+		return
+	}
+	if !active {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	cache.Rdb.Set(cache.Ctx, refreshUsedKey(hash), rec.Family, refreshTokenTTL)
+
+	writeTokenPair(w, rec.UserID, rec.Family)
+}
+
+// POST /logout → revoke the caller's token family (refresh + access tokens)
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	family := r.Context().Value(TokenFamilyKey).(string)
+	if err := revokeFamily(family); err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if authMode() == authModeCookie {
+		clearAuthCookies(w)
+	}
+
+	w.Write([]byte("Logged out successfully"))
+}
+
+// GET /.well-known/jwks.json → public keys so other services can check our tokens
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(keys.Default.JWKS())
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"itami-hypertrophy/internal/keys"
+)
+
+func TestTypedTokens(t *testing.T) {
+	token, err := signTypedToken("verify", 7, time.Minute, jwt.MapClaims{"email": "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := signTypedToken("verify", 7, -time.Minute, nil)
+	exp := time.Now().Add(time.Minute).Unix()
+	noUser, _ := keys.Default.Sign(jwt.MapClaims{"iss": tokenIssuer, "aud": typedAudience("verify"), "sub": "x", "typ": "verify", "exp": exp})
+	// typ says verify but the audience is someone else's
+	wrongAud, _ := keys.Default.Sign(jwt.MapClaims{"iss": tokenIssuer, "aud": accessAudience, "sub": "7", "typ": "verify", "exp": exp})
+	noIssuer, _ := keys.Default.Sign(jwt.MapClaims{"aud": typedAudience("verify"), "sub": "7", "typ": "verify", "exp": exp})
+	access, _ := signAccessToken(7, "f", true)
+
+	tests := []struct {
+		name   string
+		token  string
+		typ    string
+		wantID int
+	}{
+		{"right type", token, "verify", 7},
+		{"other type", token, "mfa", 0},
+		{"expired", expired, "verify", 0},
+		{"bad subject", noUser, "verify", 0},
+		{"wrong audience", wrongAud, "verify", 0},
+		{"no issuer", noIssuer, "verify", 0},
+		{"access token", access, "verify", 0},
+		{"garbage", "not.a.token", "verify", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, claims, err := parseTypedToken(tt.token, tt.typ)
+			if (err == nil) != (tt.wantID != 0) || id != tt.wantID {
+				t.Fatalf("got %d, %v; want user %d", id, err, tt.wantID)
+			}
+			if err == nil && claims["email"] != "a@example.com" {
+				t.Errorf("extra claims lost: %v", claims)
+			}
+		})
+	}
+}
+
+// everything here is refused before the session lookup, so no redis needed
+func TestJWTMiddlewareRejects(t *testing.T) {
+	t.Setenv("AUTH_MODE", "")
+	typed, _ := signTypedToken("mfa", 1, time.Minute, jwt.MapClaims{"fam": "f"})
+	// a valid access token minus or plus one thing
+	accessClaims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{"iss": tokenIssuer, "aud": accessAudience, "typ": accessType,
+			"sub": "1", "fam": "f", "exp": time.Now().Add(time.Minute).Unix()}
+		change(c)
+		return c
+	}
+	expired, _ := keys.Default.Sign(accessClaims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }))
+	noFamily, _ := keys.Default.Sign(accessClaims(func(c jwt.MapClaims) { delete(c, "fam") }))
+	noIssuer, _ := keys.Default.Sign(accessClaims(func(c jwt.MapClaims) { delete(c, "iss") }))
+	otherIssuer, _ := keys.Default.Sign(accessClaims(func(c jwt.MapClaims) { c["iss"] = "someone-else" }))
+	otherAudience, _ := keys.Default.Sign(accessClaims(func(c jwt.MapClaims) { c["aud"] = typedAudience("mfa") }))
+	noType, _ := keys.Default.Sign(accessClaims(func(c jwt.MapClaims) { delete(c, "typ") }))
+	hs256, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(func(jwt.MapClaims) {})).SignedString([]byte("secret"))
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"no token", ""},
+		{"garbage", "not.a.token"},
+		{"mfa challenge token", typed},
+		{"expired", expired},
+		{"no session family", noFamily},
+		{"no issuer", noIssuer},
+		{"other issuer", otherIssuer},
+		{"other audience", otherAudience},
+		{"no type", noType},
+		{"hs256", hs256},
+		{"personal access token", patPrefix + "whatever"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/meals", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			called := false
+			JWTMiddleware(func(http.ResponseWriter, *http.Request) { called = true })(w, r)
+
+			if called || w.Code != http.StatusUnauthorized {
+				t.Errorf("called %v, status %d; want refused with 401", called, w.Code)
+			}
+		})
+	}
+}
+
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func decodePair(t *testing.T, w *httptest.ResponseRecorder) tokenPair {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var p tokenPair
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil || p.Token == "" || p.RefreshToken == "" {
+		t.Fatalf("bad token pair %q: %v", w.Body, err)
+	}
+	return p
+}
+
+func refresh(refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(refreshRequest{RefreshToken: refreshToken})
+	r := httptest.NewRequest(http.MethodPost, "/token/refresh", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	RefreshToken(w, r)
+	return w
+}
+
+// status the protected route answers with for this access token
+func accessStatus(token string) int {
+	r := httptest.NewRequest(http.MethodGet, "/meals", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	JWTMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })(w, r)
+	return w.Code
+}
+
+func TestRefreshRotation(t *testing.T) {
+	needRedis(t)
+	t.Setenv("AUTH_MODE", "")
+	u := newTestUser(t, "rotation@example.com")
+
+	w := httptest.NewRecorder()
+	startSession(w, httptest.NewRequest(http.MethodPost, "/login", nil), u.ID, "test")
+	first := decodePair(t, w)
+	if got := accessStatus(first.Token); got != http.StatusOK {
+		t.Fatalf("fresh access token: status %d", got)
+	}
+
+	second := decodePair(t, refresh(first.RefreshToken))
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token wasn't rotated")
+	}
+	third := decodePair(t, refresh(second.RefreshToken))
+
+	// the first token again: someone kept a copy, so the whole session dies
+	if w := refresh(first.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed refresh token: status %d, want 401", w.Code)
+	}
+	if w := refresh(third.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after replay: status %d, want 401", w.Code)
+	}
+	if got := accessStatus(third.Token); got != http.StatusUnauthorized {
+		t.Errorf("access token after replay: status %d, want 401", got)
+	}
+}
+
+func TestLogoutRevokes(t *testing.T) {
+	needRedis(t)
+	t.Setenv("AUTH_MODE", "")
+	u := newTestUser(t, "logout@example.com")
+
+	w := httptest.NewRecorder()
+	startSession(w, httptest.NewRequest(http.MethodPost, "/login", nil), u.ID, "test")
+	pair := decodePair(t, w)
+
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r.Header.Set("Authorization", "Bearer "+pair.Token)
+	w = httptest.NewRecorder()
+	JWTMiddleware(Logout)(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d", w.Code)
+	}
+
+	if got := accessStatus(pair.Token); got != http.StatusUnauthorized {
+		t.Errorf("access token after logout: status %d, want 401", got)
+	}
+	if w := refresh(pair.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: status %d, want 401", w.Code)
+	}
+	if families, _ := listSessions(u.ID); len(families) != 0 {
+		t.Errorf("session still listed after logout: %+v", families)
+	}
+}
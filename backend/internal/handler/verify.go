@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"itami-hypertrophy/internal/mail"
+	"itami-hypertrophy/internal/user"
+)
+
+const verificationTTL = 48 * time.Hour
+
+// what an unverified account is allowed to do, from VERIFICATION_POLICY:
+//   - "off":   nothing special, verification is just informational
+//   - "limit": can log in and read, but not write (default)
+//   - "block": can't log in at all until verified
+const (
+	verificationOff   = "off"
+	verificationLimit = "limit"
+	verificationBlock = "block"
+)
+
+// authenticated routes an unverified user can always hit. fixing a mistyped
+// address has to work before it's verified, that's the whole point, and
+// nobody should be stuck with an account they can't delete
+var unverifiedAllowed = map[string]bool{
+	"/logout":        true,
+	"/account":       true,
+	"/account/email": true,
+}
+
+type resendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+func verificationPolicy() string {
+	switch p := os.Getenv("VERIFICATION_POLICY"); p {
+	case verificationOff, verificationBlock:
+		return p
+	default:
+		return verificationLimit
+	}
+}
+
+// applies VERIFICATION_POLICY to a request from an unverified account,
+// writes the 403 itself. same rules for JWTs and personal access tokens
+func verificationRefused(w http.ResponseWriter, r *http.Request, verified bool) bool {
+	if verified || unverifiedAllowed[r.URL.Path] {
+		return false
+	}
+	switch verificationPolicy() {
+	case verificationBlock:
+		http.Error(w, "Please verify your email first", http.StatusForbidden)
+		return true
+	case verificationLimit:
+		if r.Method != http.MethodGet {
+			http.Error(w, "Please verify your email to do that", http.StatusForbidden)
+			return true
+		}
+	}
+	return false
+}
+
+func isVerified(userID int) (bool, error) {
+	u, err := Users.ByID(userID)
+	return u.EmailVerified, err
+}
+
+// the link is a signed jwt so nothing has to be stored server side. it names
+// the address being confirmed, which is how an email change gets applied too,
+// and the address the account had when it was sent: once the account's email
+// is something else (the link was used, or another change went through) the
+// link is dead, so old links can't flip the address back
+func signVerificationToken(userID int, from, email string) (string, error) {
+	return signTypedToken("verify", userID, verificationTTL, jwt.MapClaims{"from": from, "email": email})
+}
+
+func parseVerificationToken(tokenString string) (userID int, from, email string, err error) {
+	userID, claims, err := parseTypedToken(tokenString, "verify")
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	from, _ = claims["from"].(string)
+	email, _ = claims["email"].(string)
+	if from == "" || email == "" {
+		return 0, "", "", errors.New("invalid token payload")
+	}
+	return userID, from, email, nil
+}
+
+func sendVerificationMail(userID int, email string) error {
+	u, err := Users.ByID(userID)
+	if err != nil {
+		return err
+	}
+	token, err := signVerificationToken(userID, u.Email, email)
+	if err != nil {
+		return err
+	}
+
+	return mail.Default.Send(mail.Message{
+		To:      email,
+		Subject: "Verify your Itami email",
+		Body: "Confirm this email address for your Itami account by opening this link:\n" +
+			apiURL() + "/verify?token=" + url.QueryEscape(token) + "\n\n" +
+			"The link is valid for 48 hours.",
+	})
+}
+
+// GET /verify?token=... → mark the account as verified
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, from, email, err := parseVerificationToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+
+	u, err := Users.ByID(userID)
+	if err == user.ErrNotFound || (err == nil && user.NormalizeEmail(u.Email) != user.NormalizeEmail(from)) {
+		// the account's address moved on since the link was sent
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	// for a fresh signup email is unchanged, for PATCH /account/email this swaps it in
+	err = Users.ConfirmEmail(userID, email)
+	if err == user.ErrEmailTaken {
+		http.Error(w, "Email already in use", http.StatusConflict)
+		return
+	}
+	if err == user.ErrNotFound || err == user.ErrInvalidEmail {
+		http.Error(w, "Invalid or expired verification link", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write([]byte("Email verified successfully"))
+}
+
+// POST /verify/resend → send a fresh link, no login needed since "block" mode can't log in
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req resendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	// same answer for unknown and already verified accounts
+	const reply = "If that account needs verifying, a new link has been sent"
+
+	u, err := Users.ByEmail(req.Email)
+	if err == user.ErrNotFound || (err == nil && u.EmailVerified) {
+		w.Write([]byte(reply))
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+
+	// a failed send gets the same answer too, a 500 would only ever happen for real unverified accounts
+	if err := sendVerificationMail(u.ID, u.Email); err != nil {
+		log.Println("verification mail failed:", err)
+	}
+
+	w.Write([]byte(reply))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"itami-hypertrophy/internal/db"
 	"net/http"
+	"time"
 )
 
 type StrengthWorkoutRequest struct {
@@ -19,7 +20,7 @@ func LogStrengthWorkout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Context().Value(UserEmailKey).(string)
+	userID := r.Context().Value(UserIDKey).(int)
 
 	var req StrengthWorkoutRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -29,9 +30,9 @@ func LogStrengthWorkout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	_, err = db.DB.Exec(`
-		INSERT INTO strength_workouts (email, exercise, sets, reps, weight)
+		INSERT INTO strength_workouts (user_id, exercise, sets, reps, weight)
 		VALUES ($1, $2, $3, $4, $5)
-	`, email, req.Exercise, req.Sets, req.Reps, req.Weight)
+	`, userID, req.Exercise, req.Sets, req.Reps, req.Weight)
 
 	if err != nil {
 		http.Error(w, "Failed to save workout: "+err.Error(), http.StatusInternalServerError)
@@ -42,3 +43,51 @@ func LogStrengthWorkout(w http.ResponseWriter, r *http.Request) {
 		"message": "Workout logged successfully",
 	})
 }
+
+// GET /workouts → every logged strength workout, newest first
+func GetWorkouts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value(UserIDKey).(int)
+
+	rows, err := db.DB.Query(`
+		SELECT exercise, sets, reps, weight, created_at
+		FROM strength_workouts
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch workouts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type Workout struct {
+		Exercise string  `json:"exercise"`
+		Sets     int     `json:"sets"`
+		Reps     int     `json:"reps"`
+		Weight   float64 `json:"weight"`
+		Volume   float64 `json:"volume"`
+		LoggedAt string  `json:"logged_at"`
+	}
+
+	var workouts []Workout
+	for rows.Next() {
+		var wo Workout
+		var createdAt time.Time
+		err := rows.Scan(&wo.Exercise, &wo.Sets, &wo.Reps, &wo.Weight, &createdAt)
+		if err != nil {
+			http.Error(w, "Row scan failed", http.StatusInternalServerError)
+			return
+		}
+		wo.LoggedAt = createdAt.Format(time.RFC3339)
+		wo.Volume = float64(wo.Sets*wo.Reps) * wo.Weight
+		workouts = append(workouts, wo)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workouts)
+}
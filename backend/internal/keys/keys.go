@@ -0,0 +1,232 @@
+// Package keys holds the asymmetric keys our jwts are signed with. One key
+// signs, every loaded key verifies, so rotating is: add a new key, point
+// JWT_SIGNING_KID at it, and drop the old one once its tokens have expired.
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod // RS256 or EdDSA, decided by the key type
+	Private crypto.Signer     // nil for verify-only keys
+	Public  crypto.PublicKey
+}
+
+type Manager struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+var Default *Manager
+
+// loads every *.pem in JWT_KEYS_DIR (the file name minus .pem is the kid) and
+// signs with JWT_SIGNING_KID. without a directory it refuses to start unless
+// JWT_EPHEMERAL_KEY=1 asks for a made up Ed25519 key, which is fine for local
+// dev but logs everybody out on restart and breaks with more than one instance.
+func Init() {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if os.Getenv("JWT_EPHEMERAL_KEY") != "1" {
+			panic("JWT_KEYS_DIR is not set (JWT_EPHEMERAL_KEY=1 uses a throwaway key for local dev)")
+		}
+		m, err := Ephemeral()
+		if err != nil {
+			panic(fmt.Sprintf("Failed to create signing key: %v", err))
+		}
+		Default = m
+		log.Println("⚠️ JWT_KEYS_DIR not set, using a throwaway signing key")
+		return
+	}
+
+	m, err := LoadDir(dir, os.Getenv("JWT_SIGNING_KID"))
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load JWT keys: %v", err))
+	}
+	Default = m
+	fmt.Printf("✅ Loaded %d JWT key(s), signing with %q\n", len(m.keys), m.signing.ID)
+}
+
+func Ephemeral() (*Manager, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	k, err := newKey("", priv, priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	return New(k.ID, k)
+}
+
+func New(signingKID string, keys ...*Key) (*Manager, error) {
+	m := &Manager{keys: map[string]*Key{}}
+	for _, k := range keys {
+		m.keys[k.ID] = k
+	}
+
+	m.signing = m.keys[signingKID]
+	if m.signing == nil {
+		return nil, fmt.Errorf("signing key %q not found", signingKID)
+	}
+	if m.signing.Private == nil {
+		return nil, fmt.Errorf("signing key %q has no private part", signingKID)
+	}
+	return m, nil
+}
+
+func LoadDir(dir, signingKID string) (*Manager, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*Key
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(f), ".pem")
+		k, err := ParsePEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		keys = append(keys, k)
+	}
+	return New(signingKID, keys...)
+}
+
+// accepts PKCS#8 / PKCS#1 private keys and PKIX public keys (verify only)
+func ParsePEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		return newKey(kid, signer, signer.Public())
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(kid, priv, priv.Public())
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(kid, nil, pub)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func newKey(kid string, priv crypto.Signer, pub crypto.PublicKey) (*Key, error) {
+	k := &Key{ID: kid, Private: priv, Public: pub}
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		if p.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		k.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	if k.ID == "" {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		k.ID = base64.RawURLEncoding.EncodeToString(sum[:8])
+	}
+	return k, nil
+}
+
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.signing.Method, claims)
+	token.Header["kid"] = m.signing.ID
+	return token.SignedString(m.signing.Private)
+}
+
+// the kid picks the key and the key alone decides the algorithm, so a token
+// can't talk us into HS256-with-the-public-key or "none"
+func (m *Manager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+	}
+	return k.Public, nil
+}
+
+// opts add checks on top, like the issuer and audience the caller expects
+func (m *Manager) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	opts = append([]jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithExpirationRequired(),
+	}, opts...)
+	return jwt.ParseWithClaims(tokenString, claims, m.keyFunc, opts...)
+}
+
+// RFC 7517 key set with every verification key
+type JWKS struct {
+	Keys []map[string]string `json:"keys"`
+}
+
+func (m *Manager) JWKS() JWKS {
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	set := JWKS{Keys: []map[string]string{}}
+	for _, k := range m.keys {
+		jwk := map[string]string{"kid": k.ID, "use": "sig", "alg": k.Method.Alg()}
+		switch p := k.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = b64(p.N.Bytes())
+			jwk["e"] = b64(big.NewInt(int64(p.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = b64(p)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i]["kid"] < set.Keys[j]["kid"] })
+	return set
+}
@@ -0,0 +1,257 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func edKey(t *testing.T, kid string) *Key {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := newKey(kid, priv, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func rsaKey(t *testing.T, kid string) *Key {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := newKey(kid, priv, priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// same key, minus the private part
+func verifyOnly(k *Key) *Key {
+	c := *k
+	c.Private = nil
+	return &c
+}
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestSignAndParse(t *testing.T) {
+	for _, k := range []*Key{edKey(t, "ed"), rsaKey(t, "rsa")} {
+		t.Run(k.Method.Alg(), func(t *testing.T) {
+			m, err := New(k.ID, k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := m.Sign(claims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := m.Parse(token, jwt.MapClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != k.ID {
+				t.Errorf("kid = %v, want %s", parsed.Header["kid"], k.ID)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old, next := edKey(t, "2024"), rsaKey(t, "2025")
+
+	before, err := New("2024", old, verifyOnly(next))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _ := before.Sign(claims())
+
+	// the new key signs, the old one still verifies until it's dropped
+	after, err := New("2025", verifyOnly(old), next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, _ := after.Sign(claims())
+	if _, err := after.Parse(oldToken, jwt.MapClaims{}); err != nil {
+		t.Errorf("token from the old key rejected during rotation: %v", err)
+	}
+	if _, err := before.Parse(newToken, jwt.MapClaims{}); err != nil {
+		t.Errorf("instance that hasn't switched yet rejects the new key: %v", err)
+	}
+
+	dropped, err := New("2025", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dropped.Parse(oldToken, jwt.MapClaims{}); err == nil {
+		t.Error("token from a dropped key still accepted")
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	k := edKey(t, "ed")
+	m, _ := New("ed", k)
+	other := edKey(t, "ed") // same kid, different key
+	forger, _ := New("ed", other)
+
+	pubDER, _ := x509.MarshalPKIXPublicKey(k.Public)
+	sign := func(method jwt.SigningMethod, key interface{}, header map[string]interface{}, c jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, c)
+		for h, v := range header {
+			token.Header[h] = v
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	forged, _ := forger.Sign(claims())
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown kid", sign(jwt.SigningMethodEdDSA, k.Private, map[string]interface{}{"kid": "nope"}, claims())},
+		{"no kid", sign(jwt.SigningMethodEdDSA, k.Private, nil, claims())},
+		{"hs256 with the public key", sign(jwt.SigningMethodHS256, pubDER, map[string]interface{}{"kid": "ed"}, claims())},
+		{"none", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, map[string]interface{}{"kid": "ed"}, claims())},
+		{"wrong key", forged},
+		{"expired", sign(jwt.SigningMethodEdDSA, k.Private, map[string]interface{}{"kid": "ed"},
+			jwt.MapClaims{"sub": "1", "exp": time.Now().Add(-time.Minute).Unix()})},
+		{"no expiry", sign(jwt.SigningMethodEdDSA, k.Private, map[string]interface{}{"kid": "ed"}, jwt.MapClaims{"sub": "1"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.Parse(tt.token, jwt.MapClaims{}); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	k := edKey(t, "ed")
+	if _, err := New("missing", k); err == nil {
+		t.Error("unknown signing kid accepted")
+	}
+	if _, err := New("ed", verifyOnly(k)); err == nil {
+		t.Error("verify-only signing key accepted")
+	}
+}
+
+func TestNewKeyRejectsSmallRSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newKey("small", priv, priv.Public()); err == nil {
+		t.Error("1024 bit RSA key accepted")
+	}
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edPriv)
+	writePEM(t, dir, "current.pem", "PRIVATE KEY", edDER)
+
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writePEM(t, dir, "legacy.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPriv))
+
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(otherPriv.Public())
+	writePEM(t, dir, "partner.pem", "PUBLIC KEY", pubDER)
+
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadDir(dir, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := m.JWKS()
+	if len(jwks.Keys) != 3 {
+		t.Fatalf("got %d keys in the JWKS, want 3", len(jwks.Keys))
+	}
+	want := []struct{ kid, kty, alg string }{
+		{"current", "OKP", "EdDSA"},
+		{"legacy", "RSA", "RS256"},
+		{"partner", "OKP", "EdDSA"},
+	}
+	for i, w := range want {
+		got := jwks.Keys[i]
+		if got["kid"] != w.kid || got["kty"] != w.kty || got["alg"] != w.alg || got["use"] != "sig" {
+			t.Errorf("key %d = %v, want %+v", i, got, w)
+		}
+		if _, private := got["d"]; private {
+			t.Errorf("key %s: private part in the JWKS", w.kid)
+		}
+	}
+
+	if _, err := LoadDir(dir, "partner"); err == nil {
+		t.Error("signing with a public-only key accepted")
+	}
+}
+
+func TestParsePEMRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not pem", []byte("hello")},
+		{"unknown block", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}})},
+		{"garbage key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1, 2, 3}})},
+	}
+	for _, tt := range tests {
+		if _, err := ParsePEM("k", tt.data); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
+
+func TestInitWithoutKeysDir(t *testing.T) {
+	t.Setenv("JWT_KEYS_DIR", "")
+	old := Default
+	defer func() { Default = old }()
+
+	start := func() (panicked bool) {
+		defer func() { panicked = recover() != nil }()
+		Init()
+		return false
+	}
+
+	t.Setenv("JWT_EPHEMERAL_KEY", "")
+	if !start() {
+		t.Error("started without keys and without the ephemeral opt-in")
+	}
+	t.Setenv("JWT_EPHEMERAL_KEY", "1")
+	if start() || Default == nil || Default == old {
+		t.Error("JWT_EPHEMERAL_KEY=1 didn't set up a throwaway key")
+	}
+}
@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// writes mails to Path (appending) or to stdout when Path is empty,
+// handy for local dev and tests where nothing should actually be sent
+type FileMailer struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out io.Writer = os.Stdout
+	if m.Path != "" {
+		f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	_, err := fmt.Fprintf(out, "--- %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), msg.To, msg.Subject, msg.Body)
+	return err
+}
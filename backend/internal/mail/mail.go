@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// anything that can deliver a Message (smtp in prod, a file/log sink locally)
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var Default Mailer
+
+// picks the mailer from MAIL_DRIVER: "smtp", "file" or "log". there's no
+// default, a server that quietly prints reset links to stdout instead of
+// mailing them is worse than one that doesn't start
+func Init() {
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		Default = &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			path = "mail.log"
+		}
+		Default = &FileMailer{Path: path}
+	case "log":
+		Default = &FileMailer{}
+	default:
+		panic(fmt.Sprintf("MAIL_DRIVER must be smtp, file or log, got %q", os.Getenv("MAIL_DRIVER")))
+	}
+
+	fmt.Printf("✅ Mailer ready (%T)\n", Default)
+}
@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHeaderSafe(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		ok     bool
+	}{
+		{"plain", []string{"noreply@example.com", "a@example.com", "Reset your password"}, true},
+		{"nothing", nil, true},
+		{"crlf in recipient", []string{"a@example.com\r\nBcc: b@example.com"}, false},
+		{"lf in subject", []string{"Hi\nBcc: b@example.com"}, false},
+		{"cr alone", []string{"Hi\rthere"}, false},
+	}
+	for _, tt := range tests {
+		if err := headerSafe(tt.values...); (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestSMTPRefusesInjectionBeforeConnecting(t *testing.T) {
+	// nothing listens here, so getting past the check would fail differently
+	m := &SMTPMailer{Host: "127.0.0.1", Port: "1", From: "noreply@example.com"}
+	err := m.Send(Message{To: "a@example.com\r\nBcc: b@example.com", Subject: "hi", Body: "body"})
+	if err == nil || !strings.Contains(err.Error(), "line break") {
+		t.Errorf("got %v, want the header check to refuse", err)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := &FileMailer{Path: path}
+	for _, msg := range []Message{
+		{To: "a@example.com", Subject: "First", Body: "one"},
+		{To: "b@example.com", Subject: "Second", Body: "two"},
+	} {
+		if err := m.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: a@example.com", "Subject: First", "one", "To: b@example.com", "Subject: Second", "two"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("mail log is missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{"smtp", "*mail.SMTPMailer"},
+		{"file", "*mail.FileMailer"},
+		{"log", "*mail.FileMailer"},
+		{"", ""},
+		{"sendmail", ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("MAIL_DRIVER", tt.driver)
+		got := func() (got string) {
+			defer func() {
+				if recover() != nil {
+					got = ""
+				}
+			}()
+			Init()
+			return fmt.Sprintf("%T", Default)
+		}()
+		if got != tt.want {
+			t.Errorf("MAIL_DRIVER=%q: got %q, want %q (empty for refusing to start)", tt.driver, got, tt.want)
+		}
+	}
+}
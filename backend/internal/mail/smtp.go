@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// header values go into the message as-is, a CR or LF in one would let the
+// value start headers (or the body) of its own
+func headerSafe(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("smtp send: line break in header value %q", v)
+		}
+	}
+	return nil
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := headerSafe(m.From, msg.To, msg.Subject); err != nil {
+		return err
+	}
+
+	port := m.Port
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	headers := []string{
+		"From: " + m.From,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	body := strings.Join(headers, "\r\n") + "\r\n\r\n" + msg.Body
+
+	if err := smtp.SendMail(net.JoinHostPort(m.Host, port), auth, m.From, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	return nil
+}
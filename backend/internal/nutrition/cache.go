@@ -0,0 +1,147 @@
+package nutrition
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"itami-hypertrophy/internal/cache"
+)
+
+const defaultCacheTTL = 7 * 24 * time.Hour
+
+// hit/miss counters, shared by every instance through redis
+const (
+	cacheHitsKey   = "nutrition_cache:hits"
+	cacheMissesKey = "nutrition_cache:misses"
+)
+
+type bypassKey struct{}
+
+// makes Cached skip its lookup (the fresh answer still gets stored)
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// remembers what Next said about a description in redis, so logging "2 eggs
+// and toast" every morning costs one api call a week instead of one a day
+type Cached struct {
+	Name string // part of the key, so switching providers doesn't serve old answers
+	Next Provider
+	TTL  time.Duration
+}
+
+// NUTRITION_CACHE_TTL is a duration ("168h"), "0" turns the cache off
+func cacheTTL() time.Duration {
+	v := os.Getenv("NUTRITION_CACHE_TTL")
+	if v == "" {
+		return defaultCacheTTL
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("⚠️ bad NUTRITION_CACHE_TTL %q, using %s", v, defaultCacheTTL)
+		return defaultCacheTTL
+	}
+	return d
+}
+
+var (
+	numberPattern = regexp.MustCompile(`\d*\.?\d+`)
+	// "1,000g" is a thousand grams, not "1, 0 g"
+	thousandsPattern = regexp.MustCompile(`(\d),(\d{3})(\D|$)`)
+	// "200g" → "200 g" so both spellings share a key
+	numberUnitPattern = regexp.MustCompile(`(\d)([a-z])`)
+	spacePattern      = regexp.MustCompile(`\s+`)
+	// no space before commas etc, one after
+	punctPattern = regexp.MustCompile(`\s*([,;+])\s*`)
+)
+
+// "  2 Eggs,toast " and "2.0 eggs, toast" are the same lookup
+func normalizeDescription(description string) string {
+	s := strings.ToLower(description)
+	// one comma per pass, "1,000,000" takes two
+	for t := ""; t != s; {
+		t, s = s, thousandsPattern.ReplaceAllString(s, "$1$2$3")
+	}
+	s = numberPattern.ReplaceAllStringFunc(s, func(n string) string {
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return n
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	})
+	s = numberUnitPattern.ReplaceAllString(s, "$1 $2")
+	s = punctPattern.ReplaceAllString(s, "$1 ")
+	s = spacePattern.ReplaceAllString(s, " ")
+	return strings.Trim(s, " .!,;+")
+}
+
+func (c *Cached) key(description string) string {
+	sum := sha256.Sum256([]byte(normalizeDescription(description)))
+	return "nutrition:" + c.Name + ":" + hex.EncodeToString(sum[:])
+}
+
+func (c *Cached) Lookup(ctx context.Context, description string) ([]Item, error) {
+	key := c.key(description)
+
+	if bypass, _ := ctx.Value(bypassKey{}).(bool); !bypass {
+		data, err := cache.Rdb.Get(ctx, key).Bytes()
+		if err == nil {
+			var items []Item
+			if json.Unmarshal(data, &items) == nil {
+				cache.Rdb.Incr(ctx, cacheHitsKey)
+				return items, nil
+			}
+		} else if err != redis.Nil {
+			// redis trouble shouldn't stop people from logging meals
+			log.Println("nutrition cache:", err)
+		}
+		cache.Rdb.Incr(ctx, cacheMissesKey)
+	}
+
+	items, err := c.Next.Lookup(ctx, description)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(items); err == nil {
+		if err := cache.Rdb.Set(ctx, key, data, c.TTL).Err(); err != nil {
+			log.Println("nutrition cache:", err)
+		}
+	}
+	return items, nil
+}
+
+type CacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+func GetCacheStats(ctx context.Context) (CacheStats, error) {
+	vals, err := cache.Rdb.MGet(ctx, cacheHitsKey, cacheMissesKey).Result()
+	if err != nil {
+		return CacheStats{}, err
+	}
+
+	var s CacheStats
+	if v, ok := vals[0].(string); ok {
+		s.Hits, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v, ok := vals[1].(string); ok {
+		s.Misses, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+	return s, nil
+}
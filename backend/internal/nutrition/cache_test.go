@@ -0,0 +1,77 @@
+package nutrition
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeDescription(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"2 eggs and toast", "2 eggs and toast"},
+		{"  2 Eggs  AND   Toast ", "2 eggs and toast"},
+		{"2.0 eggs", "2 eggs"},
+		{"2.50 bananas", "2.5 bananas"},
+		{".5 cup rice", "0.5 cup rice"},
+		{"200g chicken", "200 g chicken"},
+		{"200 g chicken", "200 g chicken"},
+		{"2 eggs,toast", "2 eggs, toast"},
+		{"2 eggs ; toast + jam", "2 eggs; toast+ jam"},
+		{"2 eggs, toast.", "2 eggs, toast"},
+		{"1,000g rice", "1000 g rice"},
+		{"1,000,000 g rice", "1000000 g rice"},
+		{"1,250.5 ml milk", "1250.5 ml milk"},
+		{"1,0g rice", "1, 0 g rice"},
+		{"1,0000 g rice", "1, 0 g rice"},
+		{"2 eggs,100g rice", "2 eggs, 100 g rice"},
+	}
+	for _, tt := range tests {
+		if got := normalizeDescription(tt.in); got != tt.want {
+			t.Errorf("normalizeDescription(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	c := &Cached{Name: "nutritionix"}
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"2 Eggs", "2.0 eggs", true},
+		{"200g chicken", "200 G Chicken", true},
+		{"1,000g rice", "1000 g rice", true},
+		{"1,000g rice", "1,0g rice", false},
+		{"2 eggs", "3 eggs", false},
+		{"2 eggs", "2 eggs and toast", false},
+	}
+	for _, tt := range tests {
+		if same := c.key(tt.a) == c.key(tt.b); same != tt.same {
+			t.Errorf("key(%q) == key(%q) is %v, want %v", tt.a, tt.b, same, tt.same)
+		}
+	}
+
+	other := &Cached{Name: "local"}
+	if c.key("2 eggs") == other.key("2 eggs") {
+		t.Error("two providers share a cache key")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", defaultCacheTTL},
+		{"1h", time.Hour},
+		{"0", 0},
+		{"a week", defaultCacheTTL},
+	}
+	for _, tt := range tests {
+		t.Setenv("NUTRITION_CACHE_TTL", tt.env)
+		if got := cacheTTL(); got != tt.want {
+			t.Errorf("NUTRITION_CACHE_TTL=%q: got %s, want %s", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package nutrition
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+//go:embed fixtures/foods.json
+var defaultFixtures []byte
+
+// one fixture food, macros are per serving of Grams
+type fixtureFood struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Unit    string   `json:"unit"`
+	Grams   float64  `json:"grams"`
+	Macros
+}
+
+// answers from a fixed list of foods without touching the network, so the
+// same description always gives the same numbers. good enough for local dev
+// and tests, not for real tracking
+type Fake struct {
+	foods []fixtureFood
+}
+
+func NewFake() (*Fake, error) {
+	return parseFake(defaultFixtures)
+}
+
+func LoadFake(path string) (*Fake, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFake(data)
+}
+
+func parseFake(data []byte) (*Fake, error) {
+	var foods []fixtureFood
+	if err := json.Unmarshal(data, &foods); err != nil {
+		return nil, err
+	}
+	return &Fake{foods: foods}, nil
+}
+
+func (f *Fake) Lookup(ctx context.Context, description string) ([]Item, error) {
+	var items []Item
+	for _, p := range parseDescription(description) {
+		food, ok := f.match(p.Food)
+		if !ok {
+			continue
+		}
+
+		// fixtures only know their own serving, so units other than weights
+		// are taken as "that many servings"
+		servings := p.Quantity
+		if p.Grams > 0 && food.Grams > 0 {
+			servings = p.Grams / food.Grams
+		}
+
+		items = append(items, Item{
+			Name:     food.Name,
+			Quantity: servings,
+			Unit:     food.Unit,
+			Grams:    servings * food.Grams,
+			Macros: Macros{
+				Calories: servings * food.Calories,
+				Protein:  servings * food.Protein,
+				Carbs:    servings * food.Carbs,
+				Fat:      servings * food.Fat,
+			},
+		})
+	}
+
+	if len(items) == 0 {
+		return nil, ErrNoMatch
+	}
+	return items, nil
+}
+
+// longest name/alias contained in the text wins, so "sweet potato" beats "potato"
+func (f *Fake) match(text string) (fixtureFood, bool) {
+	var best fixtureFood
+	bestLen := 0
+	for _, food := range f.foods {
+		for _, name := range append([]string{food.Name}, food.Aliases...) {
+			if len(name) > bestLen && strings.Contains(text, name) {
+				best, bestLen = food, len(name)
+			}
+		}
+	}
+	return best, bestLen > 0
+}
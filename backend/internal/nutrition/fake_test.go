@@ -0,0 +1,120 @@
+package nutrition
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFakeLookup(t *testing.T) {
+	f, err := NewFake()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		want        []Item // only name, quantity and calories are compared
+	}{
+		{"2 eggs", []Item{{Name: "egg", Quantity: 2, Macros: Macros{Calories: 144}}}},
+		{"100g egg", []Item{{Name: "egg", Quantity: 2, Macros: Macros{Calories: 144}}}},
+		{"200g chicken", []Item{{Name: "chicken breast", Quantity: 2, Macros: Macros{Calories: 330}}}},
+		{"2 eggs and a banana", []Item{
+			{Name: "egg", Quantity: 2, Macros: Macros{Calories: 144}},
+			{Name: "banana", Quantity: 1, Macros: Macros{Calories: 105}},
+		}},
+		{"2 eggs and unicorn steak", []Item{{Name: "egg", Quantity: 2, Macros: Macros{Calories: 144}}}},
+	}
+	for _, tt := range tests {
+		got, err := f.Lookup(context.Background(), tt.description)
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", tt.description, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Lookup(%q) = %+v, want %d items", tt.description, got, len(tt.want))
+			continue
+		}
+		for i, it := range got {
+			w := tt.want[i]
+			if it.Name != w.Name || math.Abs(it.Quantity-w.Quantity) > 1e-9 || math.Abs(it.Calories-w.Calories) > 1e-9 {
+				t.Errorf("Lookup(%q)[%d] = %+v, want %s x%v %v kcal", tt.description, i, it, w.Name, w.Quantity, w.Calories)
+			}
+		}
+	}
+
+	if _, err := f.Lookup(context.Background(), "unicorn steak"); err != ErrNoMatch {
+		t.Errorf("unknown food: got %v, want ErrNoMatch", err)
+	}
+}
+
+func TestFakeIsDeterministic(t *testing.T) {
+	f, err := NewFake()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := f.Lookup(context.Background(), "2 eggs and toast")
+	b, _ := f.Lookup(context.Background(), "2 eggs and toast")
+	if Sum(a) != Sum(b) {
+		t.Errorf("same description, different answers: %+v vs %+v", a, b)
+	}
+}
+
+func TestNew(t *testing.T) {
+	fixtures := filepath.Join(t.TempDir(), "foods.json")
+	if err := os.WriteFile(fixtures, []byte(`[{"name": "tofu", "unit": "serving", "grams": 100, "calories": 76}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		env      map[string]string
+		ok       bool
+	}{
+		{"fake", "fake", nil, true},
+		{"fake with own fixtures", "fake", map[string]string{"NUTRITION_FIXTURES": fixtures}, true},
+		{"fake with missing fixtures", "fake", map[string]string{"NUTRITION_FIXTURES": fixtures + ".nope"}, false},
+		{"nutritionix", "nutritionix", map[string]string{"NUTRITIONIX_APP_ID": "id", "NUTRITIONIX_APP_KEY": "key"}, true},
+		// no silent fallback to the fake
+		{"nutritionix without credentials", "nutritionix", nil, false},
+		{"nutritionix without key", "nutritionix", map[string]string{"NUTRITIONIX_APP_ID": "id"}, false},
+		{"unknown", "magic", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"NUTRITION_FIXTURES", "NUTRITIONIX_APP_ID", "NUTRITIONIX_APP_KEY"} {
+				t.Setenv(k, tt.env[k])
+			}
+			p, err := New(tt.provider)
+			if (err == nil) != tt.ok {
+				t.Fatalf("New(%q) error = %v, want ok %v", tt.provider, err, tt.ok)
+			}
+			if tt.provider == "nutritionix" && tt.ok {
+				if _, isFake := p.(*Fake); isFake {
+					t.Error("got the fake instead of nutritionix")
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFakeFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foods.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "tofu", "aliases": ["bean curd"], "unit": "serving", "grams": 100, "calories": 76}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := LoadFake(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := f.Lookup(context.Background(), "150g bean curd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Name != "tofu" || items[0].Calories != 114 {
+		t.Errorf("got %+v, want 1.5 servings of tofu", items)
+	}
+}
@@ -0,0 +1,85 @@
+package nutrition
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"itami-hypertrophy/internal/foods"
+)
+
+// answers from the local foods table (filled by cmd/importfoods), no network
+type Local struct {
+	Foods *foods.Store
+}
+
+func NewLocal(store *foods.Store) *Local {
+	return &Local{Foods: store}
+}
+
+func (l *Local) Lookup(ctx context.Context, description string) ([]Item, error) {
+	var items []Item
+	for _, p := range parseDescription(description) {
+		food, err := l.Foods.Search(ctx, p.Food)
+		if err == foods.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		grams, unit := p.Grams, p.Unit
+		if grams == 0 {
+			perUnit, label, ok := portionGrams(food.Portions, p.Unit)
+			if !ok {
+				// known food, unknown amount: same as not knowing the food
+				continue
+			}
+			unit = label
+			grams = p.Quantity * perUnit
+		}
+
+		// the table is per 100 g
+		scale := grams / 100
+		items = append(items, Item{
+			Name:     food.Name,
+			Quantity: p.Quantity,
+			Unit:     unit,
+			Grams:    grams,
+			Macros: Macros{
+				Calories: scale * food.Calories,
+				Protein:  scale * food.Protein,
+				Carbs:    scale * food.Carbs,
+				Fat:      scale * food.Fat,
+			},
+		})
+	}
+
+	if len(items) == 0 {
+		return nil, ErrNoMatch
+	}
+	return items, nil
+}
+
+var labelWords = regexp.MustCompile(`[a-z]+`)
+
+// grams in one unit of the food: the portion whose label names the unit.
+// without a unit ("2 eggs") it's the food's first (default) portion, or 100 g.
+// a unit the food has no portion for is no match, guessing would turn
+// "2 cups" into two of whatever the first portion happens to be
+func portionGrams(portions []foods.Portion, unit string) (float64, string, bool) {
+	if unit != "" {
+		for _, p := range portions {
+			for _, word := range labelWords.FindAllString(strings.ToLower(p.Label), -1) {
+				if unitNames[word] == unit {
+					return p.Grams, p.Label, true
+				}
+			}
+		}
+		return 0, "", false
+	}
+	if len(portions) > 0 {
+		return portions[0].Grams, portions[0].Label, true
+	}
+	return 100, "100 g", true
+}
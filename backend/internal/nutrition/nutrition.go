@@ -0,0 +1,117 @@
+// Package nutrition turns a free-text meal description ("2 eggs and a
+// banana") into foods with macros. Which source answers is a deployment
+// choice, see Init.
+package nutrition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"itami-hypertrophy/internal/db"
+	"itami-hypertrophy/internal/foods"
+)
+
+// none of the description could be matched to a food
+var ErrNoMatch = errors.New("no foods recognised in description")
+
+type Macros struct {
+	Calories float64 `json:"calories"`
+	Protein  float64 `json:"protein"`
+	Carbs    float64 `json:"carbs"`
+	Fat      float64 `json:"fat"`
+}
+
+func (m *Macros) Add(o Macros) {
+	m.Calories += o.Calories
+	m.Protein += o.Protein
+	m.Carbs += o.Carbs
+	m.Fat += o.Fat
+}
+
+func (m Macros) Scale(f float64) Macros {
+	return Macros{Calories: m.Calories * f, Protein: m.Protein * f, Carbs: m.Carbs * f, Fat: m.Fat * f}
+}
+
+// one recognised food, macros are for the whole quantity
+type Item struct {
+	Name     string  `json:"name"`
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+	Grams    float64 `json:"grams"`
+	Macros
+}
+
+// the same food, f times as much of it
+func (it Item) Scale(f float64) Item {
+	it.Quantity *= f
+	it.Grams *= f
+	it.Macros = it.Macros.Scale(f)
+	return it
+}
+
+// anything that can look up a description (nutritionix, the offline fake, ...)
+type Provider interface {
+	Lookup(ctx context.Context, description string) ([]Item, error)
+}
+
+var Default Provider
+
+func Sum(items []Item) Macros {
+	var total Macros
+	for _, it := range items {
+		total.Add(it.Macros)
+	}
+	return total
+}
+
+// picks the provider from NUTRITION_PROVIDER: "nutritionix" (the default),
+// "local" (the imported USDA foods, needs db.Connect first) or "fake". the
+// fake makes its numbers up from a fixture file, so it's only ever used when
+// asked for by name, and missing nutritionix credentials stop the server
+// instead of quietly falling back to it. real providers get wrapped in a
+// redis cache (needs cache.InitRedis first)
+func Init() {
+	name := os.Getenv("NUTRITION_PROVIDER")
+	if name == "" {
+		name = "nutritionix"
+	}
+
+	p, err := New(name)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to set up nutrition provider: %v", err))
+	}
+	Default = p
+
+	if name == "fake" {
+		log.Println("⚠️ Using the offline fake nutrition provider, macros are NOT real")
+	} else if ttl := cacheTTL(); ttl > 0 && name != "local" {
+		// only the remote api is worth caching. the fake answers from memory and
+		// local from our own db, where a cached answer would outlive the next import
+		Default = &Cached{Name: name, Next: p, TTL: ttl}
+	}
+	fmt.Printf("✅ Nutrition provider ready (%T)\n", Default)
+}
+
+func New(name string) (Provider, error) {
+	switch name {
+	case "nutritionix":
+		appID, appKey := os.Getenv("NUTRITIONIX_APP_ID"), os.Getenv("NUTRITIONIX_APP_KEY")
+		if appID == "" || appKey == "" {
+			return nil, errors.New("NUTRITIONIX_APP_ID and NUTRITIONIX_APP_KEY must be set (or set NUTRITION_PROVIDER=fake for offline development)")
+		}
+		return NewNutritionix(appID, appKey), nil
+	case "local":
+		return NewLocal(foods.NewStore(db.DB)), nil
+	case "fake":
+		// NUTRITION_FIXTURES swaps the built-in fixture file for another one
+		if path := os.Getenv("NUTRITION_FIXTURES"); path != "" {
+			return LoadFake(path)
+		}
+		return NewFake()
+	default:
+		return nil, fmt.Errorf("unknown nutrition provider %q", name)
+	}
+}
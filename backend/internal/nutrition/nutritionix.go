@@ -0,0 +1,94 @@
+package nutrition
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const nutritionixURL = "https://trackapi.nutritionix.com"
+
+// the natural language endpoint of nutritionix, BaseURL can point at a mock
+type Nutritionix struct {
+	AppID   string
+	AppKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewNutritionix(appID, appKey string) *Nutritionix {
+	base := os.Getenv("NUTRITIONIX_URL")
+	if base == "" {
+		base = nutritionixURL
+	}
+	return &Nutritionix{
+		AppID:   appID,
+		AppKey:  appKey,
+		BaseURL: strings.TrimSuffix(base, "/"),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *Nutritionix) Lookup(ctx context.Context, description string) ([]Item, error) {
+	jsonData, _ := json.Marshal(map[string]string{"query": description})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.BaseURL+"/v2/natural/nutrients", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-app-id", n.AppID)
+	req.Header.Set("x-app-key", n.AppKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// nutritionix answers 404 when it couldn't match any food
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNoMatch
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("nutritionix: %s: %s", resp.Status, body)
+	}
+
+	var response struct {
+		Foods []struct {
+			Name     string  `json:"food_name"`
+			Quantity float64 `json:"serving_qty"`
+			Unit     string  `json:"serving_unit"`
+			Grams    float64 `json:"serving_weight_grams"`
+			Calories float64 `json:"nf_calories"`
+			Protein  float64 `json:"nf_protein"`
+			Carbs    float64 `json:"nf_total_carbohydrate"`
+			Fat      float64 `json:"nf_total_fat"`
+		} `json:"foods"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("nutritionix: failed to parse response: %w", err)
+	}
+	if len(response.Foods) == 0 {
+		return nil, ErrNoMatch
+	}
+
+	items := make([]Item, 0, len(response.Foods))
+	for _, f := range response.Foods {
+		items = append(items, Item{
+			Name:     f.Name,
+			Quantity: f.Quantity,
+			Unit:     f.Unit,
+			Grams:    f.Grams,
+			Macros:   Macros{Calories: f.Calories, Protein: f.Protein, Carbs: f.Carbs, Fat: f.Fat},
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,121 @@
+package nutrition
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// one food out of a description: "1 1/2 cups of rice" → {1.5, "cup", 0, "rice"}
+type portion struct {
+	Quantity float64
+	Unit     string  // canonical unit, "" when none was given
+	Grams    float64 // set when the unit is a weight, so no portion lookup is needed
+	Food     string
+}
+
+// weights (and volumes of water-like stuff) convert straight to grams
+var gramsPer = map[string]float64{
+	"g":  1,
+	"kg": 1000,
+	"mg": 0.001,
+	"oz": 28.3495,
+	"lb": 453.592,
+	"ml": 1, // close enough for drinks
+	"l":  1000,
+}
+
+// spelling → canonical unit. anything not in gramsPer has to be resolved
+// per food (a cup of rice and a cup of milk weigh different things)
+var unitNames = map[string]string{
+	"g": "g", "gr": "g", "gram": "g", "grams": "g",
+	"kg": "kg", "kgs": "kg", "kilo": "kg", "kilos": "kg", "kilogram": "kg", "kilograms": "kg",
+	"mg": "mg", "milligram": "mg", "milligrams": "mg",
+	"oz": "oz", "ounce": "oz", "ounces": "oz",
+	"lb": "lb", "lbs": "lb", "pound": "lb", "pounds": "lb",
+	"ml": "ml", "milliliter": "ml", "milliliters": "ml", "millilitre": "ml", "millilitres": "ml",
+	"l": "l", "liter": "l", "liters": "l", "litre": "l", "litres": "l",
+	"cup": "cup", "cups": "cup",
+	"tbsp": "tbsp", "tbs": "tbsp", "tablespoon": "tbsp", "tablespoons": "tbsp",
+	"tsp": "tsp", "teaspoon": "tsp", "teaspoons": "tsp",
+	"slice": "slice", "slices": "slice",
+	"piece": "piece", "pieces": "piece", "pc": "piece", "pcs": "piece",
+	"serving": "serving", "servings": "serving",
+	"scoop": "scoop", "scoops": "scoop",
+	"can": "can", "cans": "can",
+	"small": "small", "medium": "medium", "large": "large",
+}
+
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "half": 0.5,
+	"½": 0.5, "¼": 0.25, "¾": 0.75,
+}
+
+var (
+	// "2 eggs, toast and a banana" → "2 eggs" / "toast" / "a banana"
+	partSplitter = regexp.MustCompile(`\s*(?:,|;|\+|\band\b|\bwith\b)\s*`)
+	// leading amount: "2", "1.5", "1/2", "1 1/2", "a", "two", "½", plus an optional "x"
+	amountPattern = regexp.MustCompile(`^(\d+\s+\d+/\d+|\d+/\d+|\d+(?:\.\d+)?|[½¼¾]|an?\b|one\b|two\b|three\b|four\b|five\b|six\b|half\b)\s*(?:x\s+)?`)
+	// unit right after the amount, "200g" and "200 g" both work
+	unitPattern = regexp.MustCompile(`^([a-z]+)\.?\s*(?:of\s+)?`)
+)
+
+func parseAmount(s string) float64 {
+	if n, ok := numberWords[s]; ok {
+		return n
+	}
+	whole, frac := 0.0, s
+	if w, f, ok := strings.Cut(s, " "); ok {
+		whole, _ = strconv.ParseFloat(w, 64)
+		frac = strings.TrimSpace(f)
+	}
+	if num, den, ok := strings.Cut(frac, "/"); ok {
+		n, _ := strconv.ParseFloat(num, 64)
+		d, _ := strconv.ParseFloat(den, 64)
+		if d > 0 {
+			return whole + n/d
+		}
+		return whole
+	}
+	n, _ := strconv.ParseFloat(frac, 64)
+	return whole + n
+}
+
+// splits a description into its foods, each with amount and unit. parts
+// without an amount count as one of whatever the food's default portion is
+func parseDescription(description string) []portion {
+	var parts []portion
+	for _, text := range partSplitter.Split(strings.ToLower(description), -1) {
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+
+		p := portion{Quantity: 1}
+		if m := amountPattern.FindStringSubmatch(text); m != nil {
+			p.Quantity = parseAmount(m[1])
+			rest := text[len(m[0]):]
+
+			if u := unitPattern.FindStringSubmatch(rest); u != nil {
+				// only a unit if there's still a food name after it ("2 large eggs", not "2 eggs")
+				if unit, ok := unitNames[u[1]]; ok && strings.TrimSpace(rest[len(u[0]):]) != "" {
+					p.Unit = unit
+					rest = rest[len(u[0]):]
+				}
+			}
+			text = rest
+		}
+
+		if g, ok := gramsPer[p.Unit]; ok {
+			p.Grams = p.Quantity * g
+		}
+		// "half an avocado", "a slice of bread"
+		p.Food = strings.TrimSpace(text)
+		for _, filler := range []string{"an ", "a ", "of "} {
+			p.Food = strings.TrimPrefix(p.Food, filler)
+		}
+		if p.Food != "" && p.Quantity > 0 {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
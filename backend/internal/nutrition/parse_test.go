@@ -0,0 +1,97 @@
+package nutrition
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"itami-hypertrophy/internal/foods"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"2", 2},
+		{"1.5", 1.5},
+		{"1/2", 0.5},
+		{"1 1/2", 1.5},
+		{"3/0", 0},
+		{"a", 1},
+		{"two", 2},
+		{"half", 0.5},
+		{"½", 0.5},
+	}
+	for _, tt := range tests {
+		if got := parseAmount(tt.in); got != tt.want {
+			t.Errorf("parseAmount(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDescription(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []portion
+	}{
+		{"200g chicken breast", []portion{{200, "g", 200, "chicken breast"}}},
+		{"200 grams of chicken", []portion{{200, "g", 200, "chicken"}}},
+		{"1.5 kg potatoes", []portion{{1.5, "kg", 1500, "potatoes"}}},
+		{"1 1/2 cups of rice", []portion{{1.5, "cup", 0, "rice"}}},
+		{"2 large eggs", []portion{{2, "large", 0, "eggs"}}},
+		{"2 eggs", []portion{{2, "", 0, "eggs"}}},
+		{"2 x eggs", []portion{{2, "", 0, "eggs"}}},
+		{"half an avocado", []portion{{0.5, "", 0, "avocado"}}},
+		{"a slice of bread", []portion{{1, "slice", 0, "bread"}}},
+		{"toast", []portion{{1, "", 0, "toast"}}},
+		{"2 Eggs, toast and a banana", []portion{
+			{2, "", 0, "eggs"},
+			{1, "", 0, "toast"},
+			{1, "", 0, "banana"},
+		}},
+		{"rice with 100g beef; salad + 1 tbsp oil", []portion{
+			{1, "", 0, "rice"},
+			{100, "g", 100, "beef"},
+			{1, "", 0, "salad"},
+			{1, "tbsp", 0, "oil"},
+		}},
+		{"0 eggs", nil},
+		{" , and ", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseDescription(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDescription(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPortionGrams(t *testing.T) {
+	portions := []foods.Portion{
+		{Label: "1 medium", Grams: 118},
+		{Label: "cup, sliced", Grams: 150},
+	}
+	tests := []struct {
+		name      string
+		portions  []foods.Portion
+		unit      string
+		wantGrams float64
+		wantLabel string
+		wantOK    bool
+	}{
+		{"matching unit", portions, "cup", 150, "cup, sliced", true},
+		{"no unit → first portion", portions, "", 118, "1 medium", true},
+		{"no unit, no portions → 100 g", nil, "", 100, "100 g", true},
+		{"unknown unit", portions, "slice", 0, "", false},
+		{"unit, no portions", nil, "cup", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grams, label, ok := portionGrams(tt.portions, tt.unit)
+			if ok != tt.wantOK || math.Abs(grams-tt.wantGrams) > 1e-9 || label != tt.wantLabel {
+				t.Errorf("got %v %q %v, want %v %q %v", grams, label, ok, tt.wantGrams, tt.wantLabel, tt.wantOK)
+			}
+		})
+	}
+}
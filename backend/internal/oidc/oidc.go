@@ -0,0 +1,433 @@
+// Package oidc is a small OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE, and id token verification against the
+// provider's published keys. Any spec-following provider works, including a
+// local mock server, as long as it is listed in OIDC_PROVIDERS.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// don't hammer the provider's jwks endpoint when tokens with unknown kids show up
+const keysRefreshInterval = time.Minute
+
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients, PKCE covers those
+	Scopes       []string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// the parts of /.well-known/openid-configuration we use
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// what we take out of a verified id token
+type Claims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Nonce         string `json:"nonce"`
+	// when the user last actually signed in at the provider, always there when max_age was asked for
+	AuthTime int64 `json:"auth_time"`
+}
+
+var Providers = map[string]*Provider{}
+
+// OIDC_PROVIDERS=google,dev turns on "google" and "dev", each configured with
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and
+// optionally OIDC_<NAME>_SCOPES (space separated, "openid email" by default)
+func Init() {
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		env := func(key string) string {
+			return os.Getenv("OIDC_" + strings.ToUpper(name) + "_" + key)
+		}
+
+		p := NewProvider(name, env("ISSUER"), env("CLIENT_ID"), env("CLIENT_SECRET"))
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Printf("⚠️ OIDC provider %q needs an issuer and a client id, skipping it", name)
+			continue
+		}
+		if scopes := env("SCOPES"); scopes != "" {
+			p.Scopes = strings.Fields(scopes)
+		}
+		Providers[name] = p
+		fmt.Printf("✅ OIDC provider %q (%s)\n", name, p.Issuer)
+	}
+}
+
+func NewProvider(name, issuer, clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name:         name,
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       []string{"openid", "email"},
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// configured provider names, sorted, for the login page
+func Names() []string {
+	names := []string{}
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// random url-safe string, used for state, nonce and the PKCE verifier
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// S256 code challenge for a PKCE verifier (RFC 7636)
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discovery is fetched once and kept, a failed fetch is retried next time
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var m metadata
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q doesn't match %q", m.Issuer, p.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	p.meta = &m
+	return p.meta, nil
+}
+
+// where to send the browser to log in
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURI, state, nonce, verifier string, extra url.Values) (string, error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	// prompt, max_age, ...
+	for k, v := range extra {
+		q[k] = v
+	}
+
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// trades the code from the callback for an id token and verifies it
+func (p *Provider) Exchange(ctx context.Context, redirectURI, code, verifier, nonce string) (*Claims, error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token endpoint: %s: %s", resp.Status, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("oidc token endpoint: no id_token in response")
+	}
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// checks signature, issuer, audience, expiry and nonce of an id token
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, p.keyFunc(ctx),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc id token: no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("oidc id token: nonce mismatch")
+	}
+	return &claims, nil
+}
+
+func (p *Provider) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// same idea as internal/keys: the key decides which family of algs is ok
+		ok := false
+		switch key.(type) {
+		case *rsa.PublicKey:
+			_, ok = token.Method.(*jwt.SigningMethodRSA)
+			if !ok {
+				_, ok = token.Method.(*jwt.SigningMethodRSAPSS)
+			}
+		case *ecdsa.PublicKey:
+			_, ok = token.Method.(*jwt.SigningMethodECDSA)
+		case ed25519.PublicKey:
+			_, ok = token.Method.(*jwt.SigningMethodEd25519)
+		}
+		if !ok {
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		return key, nil
+	}
+}
+
+// looks the kid up in the cached key set, refetching it (at most once a
+// minute) when the provider has rotated to a key we haven't seen yet
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k := p.lookup(kid); k != nil {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, m.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys, p.keysFetched = keys, time.Now()
+
+	if k := p.lookup(kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// a token without a kid is fine as long as the provider only has one key
+func (p *Provider) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return p.keys[kid]
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// one odd key shouldn't take the others down with it
+			log.Printf("oidc %s: skipping key %q: %v", p.Name, k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return pub, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,273 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "itami"
+	testRedirect = "http://localhost/callback"
+)
+
+// a minimal provider: discovery, one Ed25519 key, and a token endpoint that
+// does the PKCE check itself and hands out whatever id token is queued
+type mockProvider struct {
+	*httptest.Server
+	priv ed25519.PrivateKey
+	kid  string
+
+	challenge string // from the last authorize url the test "followed"
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{priv: priv, kid: "k1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": m.kid, "kty": "OKP", "crv": "Ed25519", "use": "sig",
+			"x": base64.RawURLEncoding.EncodeToString(pub),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("grant_type") != "authorization_code" || r.FormValue("code") != "the-code" ||
+			r.FormValue("redirect_uri") != testRedirect ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, m.claims)})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = m.kid
+	s, err := token.SignedString(m.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func (m *mockProvider) validClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "a@example.com",
+		"email_verified": true,
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Challenge(verifier)
+	// 32 bytes of sha256, base64url without padding
+	if len(c) != 43 || strings.ContainsAny(c, "+/=") {
+		t.Errorf("Challenge = %q, want 43 url-safe characters", c)
+	}
+	if c == Challenge(verifier+"x") {
+		t.Error("different verifiers give the same challenge")
+	}
+	if other, _ := RandomString(); other == verifier {
+		t.Error("RandomString repeated itself")
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	m := newMockProvider(t)
+	p := NewProvider("mock", m.URL+"/", testClientID, "")
+
+	target, err := p.AuthCodeURL(context.Background(), testRedirect, "st", "no", "verifier",
+		url.Values{"prompt": {"login"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != m.URL+"/authorize" {
+		t.Errorf("endpoint = %s", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirect,
+		"scope":                 "openid email",
+		"state":                 "st",
+		"nonce":                 "no",
+		"code_challenge":        Challenge("verifier"),
+		"code_challenge_method": "S256",
+		"prompt":                "login",
+	}
+	for k, v := range want {
+		if got := u.Query().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	if u.Query().Has("code_verifier") {
+		t.Error("the verifier went out in the browser redirect")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	p := NewProvider("mock", m.URL, testClientID, "")
+	ctx := context.Background()
+
+	target, err := p.AuthCodeURL(ctx, testRedirect, "st", "the-nonce", "the-verifier", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(target)
+	m.challenge = u.Query().Get("code_challenge")
+	m.claims = m.validClaims("the-nonce")
+
+	claims, err := p.Exchange(ctx, testRedirect, "the-code", "the-verifier", "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "a@example.com" || !claims.EmailVerified {
+		t.Errorf("got %+v", claims)
+	}
+
+	// someone who intercepted the code but not the verifier gets nothing
+	if _, err := p.Exchange(ctx, testRedirect, "the-code", "another-verifier", "the-nonce"); err == nil {
+		t.Error("exchange with the wrong verifier succeeded")
+	}
+	if _, err := p.Exchange(ctx, testRedirect, "the-code", "the-verifier", "another-nonce"); err == nil {
+		t.Error("exchange with the wrong nonce succeeded")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m := newMockProvider(t)
+	p := NewProvider("mock", m.URL, testClientID, "")
+
+	with := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := m.validClaims("n")
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	forged := func() string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, m.validClaims("n"))
+		token.Header["kid"] = m.kid
+		s, _ := token.SignedString(otherPriv)
+		return s
+	}
+	hs256 := func() string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, m.validClaims("n"))
+		token.Header["kid"] = m.kid
+		s, _ := token.SignedString([]byte("secret"))
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", m.sign(t, m.validClaims("n")), true},
+		{"wrong nonce", m.sign(t, m.validClaims("other")), false},
+		{"wrong issuer", m.sign(t, with(jwt.MapClaims{"iss": "https://evil.example"})), false},
+		{"wrong audience", m.sign(t, with(jwt.MapClaims{"aud": "someone-else"})), false},
+		{"expired", m.sign(t, with(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})), false},
+		{"no expiry", m.sign(t, with(jwt.MapClaims{"exp": nil})), false},
+		{"no subject", m.sign(t, with(jwt.MapClaims{"sub": nil})), false},
+		{"signed by someone else", forged(), false},
+		{"hs256", hs256(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Verify(context.Background(), tt.token, "n")
+			if (err == nil) != tt.ok {
+				t.Errorf("Verify error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	// metadata claiming to be some other issuer
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 "https://evil.example",
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	}))
+	defer srv.Close()
+
+	p := NewProvider("mock", srv.URL, testClientID, "")
+	if _, err := p.AuthCodeURL(context.Background(), testRedirect, "s", "n", "v", nil); err == nil {
+		t.Error("metadata for another issuer accepted")
+	}
+}
+
+func TestJWKPublicKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  jwk
+		ok   bool
+	}{
+		{"ed25519", jwk{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(make([]byte, 32))}, true},
+		{"short ed25519", jwk{Kty: "OKP", Crv: "Ed25519", X: "AAAA"}, false},
+		{"other okp curve", jwk{Kty: "OKP", Crv: "X25519", X: base64.RawURLEncoding.EncodeToString(make([]byte, 32))}, false},
+		{"small rsa", jwk{Kty: "RSA", N: base64.RawURLEncoding.EncodeToString(make([]byte, 128)), E: "AQAB"}, false},
+		{"ec point off the curve", jwk{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}, false},
+		{"unknown type", jwk{Kty: "oct"}, false},
+	}
+	for _, tt := range tests {
+		if _, err := tt.key.publicKey(); (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the RFC 6238 appendix B key ("12345678901234567890") in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeAtRFCVectors(t *testing.T) {
+	// appendix B lists 8 digits, we use the last 6
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := CodeAt(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeAtBadSecret(t *testing.T) {
+	if _, err := CodeAt("not base32!", 1); err == nil {
+		t.Error("invalid secret was accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := func(offset int64) string {
+		c, err := CodeAt(rfcSecret, Step(now)+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		ok       bool
+		wantStep int64
+	}{
+		{"current step", rfcSecret, code(0), true, Step(now)},
+		{"one step behind", rfcSecret, code(-1), true, Step(now) - 1},
+		{"one step ahead", rfcSecret, code(1), true, Step(now) + 1},
+		{"too old", rfcSecret, code(-2), false, 0},
+		{"too far ahead", rfcSecret, code(2), false, 0},
+		{"surrounding spaces", rfcSecret, " " + code(0) + " ", true, Step(now)},
+		{"lowercase secret", strings.ToLower(rfcSecret), code(0), true, Step(now)},
+		{"too short", rfcSecret, code(0)[:5], false, 0},
+		{"too long", rfcSecret, code(0) + "0", false, 0},
+		{"empty", rfcSecret, "", false, 0},
+		{"bad secret", "not base32!", code(0), false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, now)
+			if ok != tt.ok || step != tt.wantStep {
+				t.Errorf("Validate = %d %v, want %d %v", step, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateSecret()
+	if a == b {
+		t.Error("two secrets came out the same")
+	}
+	key, err := b32.DecodeString(a)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes (%v), want 20", a, len(key), err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Itami", "a@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Itami:a@example.com" {
+		t.Errorf("got %s", u)
+	}
+	q := u.Query()
+	want := map[string]string{"secret": rfcSecret, "issuer": "Itami", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+}
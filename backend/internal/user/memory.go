@@ -0,0 +1,155 @@
+package user
+
+import (
+	"sync"
+	"time"
+)
+
+// keeps users in a map, for tests and one-off tools that don't need postgres
+type MemoryRepository struct {
+	mu         sync.Mutex
+	nextID     int
+	users      map[int]User
+	identities map[string]int       // "provider|subject" → user id
+	tombstones map[string]time.Time // hashed email → when it was deleted
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{users: map[int]User{}, identities: map[string]int{}, tombstones: map[string]time.Time{}}
+}
+
+func (r *MemoryRepository) findEmail(email string) (User, bool) {
+	for _, u := range r.users {
+		if NormalizeEmail(u.Email) == NormalizeEmail(email) {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+func (r *MemoryRepository) Create(email, passwordHash string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.findEmail(email); ok {
+		return User{}, ErrEmailTaken
+	}
+	r.nextID++
+	u := User{ID: r.nextID, Email: email, PasswordHash: passwordHash}
+	r.users[u.ID] = u
+	return u, nil
+}
+
+func (r *MemoryRepository) ByID(id int) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *MemoryRepository) ByEmail(email string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.findEmail(email)
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *MemoryRepository) UpdatePassword(id int, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.PasswordHash = passwordHash
+	r.users[id] = u
+	return nil
+}
+
+func (r *MemoryRepository) ConfirmEmail(id int, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if other, taken := r.findEmail(email); taken && other.ID != id {
+		return ErrEmailTaken
+	}
+	u.Email = email
+	u.EmailVerified = true
+	r.users[id] = u
+	return nil
+}
+
+func (r *MemoryRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.users, id)
+	r.tombstones[HashEmail(u.Email)] = time.Now()
+	for k, uid := range r.identities {
+		if uid == id {
+			delete(r.identities, k)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) ByIdentity(provider, subject string) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[r.identities[provider+"|"+subject]]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *MemoryRepository) LinkIdentity(id int, provider, subject string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return ErrNotFound
+	}
+	if _, taken := r.identities[provider+"|"+subject]; !taken {
+		r.identities[provider+"|"+subject] = id
+	}
+	return nil
+}
+
+func (r *MemoryRepository) UnlinkIdentities(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, uid := range r.identities {
+		if uid == id {
+			delete(r.identities, k)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) DeletedSince(email string, since time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at, ok := r.tombstones[HashEmail(email)]
+	return ok && at.After(since), nil
+}
@@ -0,0 +1,71 @@
+package user
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, p := range strings.Fields(commonPasswordList) {
+		m[p] = true
+	}
+	return m
+}()
+
+// what a new password has to satisfy, and how hard it gets hashed
+type PasswordPolicy struct {
+	MinLength int
+	// bcrypt cost for new hashes; older hashes with a lower cost are
+	// upgraded the next time the user logs in
+	Cost int
+}
+
+// rejection reason, safe to show to the user
+type PasswordError struct {
+	Reason string
+}
+
+func (e *PasswordError) Error() string { return e.Reason }
+
+func DefaultPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, Cost: bcrypt.DefaultCost}
+}
+
+// PASSWORD_MIN_LENGTH and BCRYPT_COST override the defaults
+func PolicyFromEnv() PasswordPolicy {
+	p := DefaultPolicy()
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		p.MinLength = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("BCRYPT_COST")); err == nil && n >= bcrypt.MinCost && n <= bcrypt.MaxCost {
+		p.Cost = n
+	}
+	return p
+}
+
+func (p PasswordPolicy) Check(password, email string) error {
+	if len([]rune(password)) < p.MinLength {
+		return &PasswordError{fmt.Sprintf("password must be at least %d characters", p.MinLength)}
+	}
+	// bcrypt silently ignores everything past 72 bytes
+	if len(password) > 72 {
+		return &PasswordError{"password must be at most 72 bytes"}
+	}
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return &PasswordError{"password is too common"}
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		return &PasswordError{"password can't be your email"}
+	}
+	return nil
+}
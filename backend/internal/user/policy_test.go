@@ -0,0 +1,55 @@
+package user
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	p := PasswordPolicy{MinLength: 8}
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		ok       bool
+	}{
+		{"ok", "correct horse battery", "a@example.com", true},
+		{"too short", "short", "", false},
+		{"runes not bytes", "ääääääää", "", true},
+		{"past bcrypt's limit", strings.Repeat("x", 73), "", false},
+		{"exactly bcrypt's limit", strings.Repeat("x", 72), "", true},
+		{"common", "password123", "", false},
+		{"common in other case", "PassWord123", "", false},
+		{"same as the email", "Alice@Example.com", "alice@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(tt.password, tt.email)
+			if (err == nil) != tt.ok {
+				t.Errorf("Check(%q) = %v, want ok %v", tt.password, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		minLength string
+		cost      string
+		want      PasswordPolicy
+	}{
+		{"defaults", "", "", DefaultPolicy()},
+		{"overrides", "12", "11", PasswordPolicy{MinLength: 12, Cost: 11}},
+		{"nonsense is ignored", "-1", "99", DefaultPolicy()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PASSWORD_MIN_LENGTH", tt.minLength)
+			t.Setenv("BCRYPT_COST", tt.cost)
+			if got := PolicyFromEnv(); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
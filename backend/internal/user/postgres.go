@@ -0,0 +1,130 @@
+package user
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PostgresRepository struct {
+	DB *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{DB: db}
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+func (r *PostgresRepository) Create(email, passwordHash string) (User, error) {
+	u := User{Email: email, PasswordHash: passwordHash}
+	err := r.DB.QueryRow("INSERT INTO users (email, password) VALUES ($1, $2) RETURNING id", email, passwordHash).Scan(&u.ID)
+	if isUniqueViolation(err) {
+		return User{}, ErrEmailTaken
+	}
+	return u, err
+}
+
+func (r *PostgresRepository) scanOne(query string, arg interface{}) (User, error) {
+	var u User
+	err := r.DB.QueryRow(query, arg).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.EmailVerified)
+	if err == sql.ErrNoRows {
+		return User{}, ErrNotFound
+	}
+	return u, err
+}
+
+func (r *PostgresRepository) ByID(id int) (User, error) {
+	return r.scanOne("SELECT id, email, password, email_verified FROM users WHERE id = $1", id)
+}
+
+func (r *PostgresRepository) ByEmail(email string) (User, error) {
+	// lower() so older mixed-case rows still match and the unique index gets used
+	return r.scanOne("SELECT id, email, password, email_verified FROM users WHERE lower(email) = $1", NormalizeEmail(email))
+}
+
+func (r *PostgresRepository) exec(query string, args ...interface{}) error {
+	res, err := r.DB.Exec(query, args...)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresRepository) UpdatePassword(id int, passwordHash string) error {
+	return r.exec("UPDATE users SET password = $2 WHERE id = $1", id, passwordHash)
+}
+
+func (r *PostgresRepository) ConfirmEmail(id int, email string) error {
+	return r.exec("UPDATE users SET email = $2, email_verified = TRUE WHERE id = $1", id, email)
+}
+
+func (r *PostgresRepository) ByIdentity(provider, subject string) (User, error) {
+	var u User
+	err := r.DB.QueryRow(`
+		SELECT u.id, u.email, u.password, u.email_verified
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2
+	`, provider, subject).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.EmailVerified)
+	if err == sql.ErrNoRows {
+		return User{}, ErrNotFound
+	}
+	return u, err
+}
+
+func (r *PostgresRepository) LinkIdentity(id int, provider, subject string) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject) VALUES ($1, $2, $3)
+		ON CONFLICT (provider, subject) DO NOTHING
+	`, id, provider, subject)
+	return err
+}
+
+func (r *PostgresRepository) UnlinkIdentities(id int) error {
+	_, err := r.DB.Exec("DELETE FROM user_identities WHERE user_id = $1", id)
+	return err
+}
+
+// meals, workouts, goals and profile go with it via ON DELETE CASCADE,
+// a tombstone with the hashed email is left behind in the same transaction
+func (r *PostgresRepository) Delete(id int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var email string
+	err = tx.QueryRow("DELETE FROM users WHERE id = $1 RETURNING email", id).Scan(&email)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO account_tombstones (user_id, email_hash) VALUES ($1, $2)", id, HashEmail(email))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) DeletedSince(email string, since time.Time) (bool, error) {
+	var deleted bool
+	err := r.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM account_tombstones WHERE email_hash = $1 AND deleted_at > $2)
+	`, HashEmail(email), since).Scan(&deleted)
+	return deleted, err
+}
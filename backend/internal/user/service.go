@@ -0,0 +1,220 @@
+package user
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// how long the address of a deleted account stays blocked for new signups.
+// longer than anything we mail out stays valid (verification links, 48h), so
+// nothing sent to the old owner can end up working for whoever takes it next
+const DefaultReuseCooldown = 7 * 24 * time.Hour
+
+// all the account logic lives here, http handlers (and anything else) just call it
+type Service struct {
+	repo   Repository
+	policy PasswordPolicy
+	// 0 lets a deleted account's address be registered again right away
+	ReuseCooldown time.Duration
+}
+
+func NewService(repo Repository, policy PasswordPolicy) *Service {
+	return &Service{repo: repo, policy: policy, ReuseCooldown: DefaultReuseCooldown}
+}
+
+// ACCOUNT_REUSE_COOLDOWN is a duration ("72h"), "0" turns the check off
+func ReuseCooldownFromEnv() time.Duration {
+	v := os.Getenv("ACCOUNT_REUSE_COOLDOWN")
+	if v == "" {
+		return DefaultReuseCooldown
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("⚠️ bad ACCOUNT_REUSE_COOLDOWN %q, using %s", v, DefaultReuseCooldown)
+		return DefaultReuseCooldown
+	}
+	return d
+}
+
+// every new account goes through here, so the tombstone check can't be skipped
+func (s *Service) create(email, passwordHash string) (User, error) {
+	if s.ReuseCooldown > 0 {
+		deleted, err := s.repo.DeletedSince(email, time.Now().Add(-s.ReuseCooldown))
+		if err != nil {
+			return User{}, err
+		}
+		if deleted {
+			return User{}, ErrEmailRecentlyDeleted
+		}
+	}
+	return s.repo.Create(email, passwordHash)
+}
+
+func (s *Service) hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), s.policy.Cost)
+	return string(hashed), err
+}
+
+func (s *Service) Create(email, password string) (User, error) {
+	email = NormalizeEmail(email)
+	if email == "" || password == "" {
+		return User{}, ErrInvalidInput
+	}
+	if !ValidEmail(email) {
+		return User{}, ErrInvalidEmail
+	}
+	if err := s.policy.Check(password, email); err != nil {
+		return User{}, err
+	}
+
+	hashed, err := s.hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	return s.create(email, hashed)
+}
+
+// checks email + password, unknown email and wrong password look the same
+func (s *Service) Authenticate(email, password string) (User, error) {
+	u, err := s.repo.ByEmail(NormalizeEmail(email))
+	if err == ErrNotFound {
+		return User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+
+	// only moment we have the plaintext, so this is where weak hashes get upgraded
+	if cost, err := bcrypt.Cost([]byte(u.PasswordHash)); err == nil && cost < s.policy.Cost {
+		if hashed, err := s.hashPassword(password); err == nil && s.repo.UpdatePassword(u.ID, hashed) == nil {
+			u.PasswordHash = hashed
+		}
+	}
+	return u, nil
+}
+
+// signs in someone coming back from an external provider. a known identity
+// is just looked up; otherwise the provider has to have verified the email,
+// and it gets linked to the account with that email (only if the account has
+// verified it too) or a new account is made. those accounts have no password
+// until the user resets one.
+func (s *Service) LoginWithIdentity(provider, subject, email string, emailVerified bool) (User, error) {
+	u, err := s.repo.ByIdentity(provider, subject)
+	if err != ErrNotFound {
+		return u, err
+	}
+	email = NormalizeEmail(email)
+	if email == "" {
+		return User{}, ErrInvalidInput
+	}
+	if !ValidEmail(email) {
+		return User{}, ErrInvalidEmail
+	}
+	if !emailVerified {
+		// otherwise anyone could claim an address at a sloppy provider, either
+		// taking over the account or squatting it before the owner signs up
+		return User{}, ErrIdentityEmailUnverified
+	}
+
+	u, err = s.repo.ByEmail(email)
+	switch {
+	case err == ErrNotFound:
+		// an empty hash never matches, so password login stays closed
+		u, err = s.create(email, "")
+		if err != nil {
+			return User{}, err
+		}
+	case err != nil:
+		return User{}, err
+	case !u.EmailVerified:
+		// someone may have registered the address before its owner showed up, linking
+		// would hand the owner an account whose password (and sessions, tokens) the
+		// squatter still has. the owner can take it over through the reset mail instead
+		return User{}, ErrAccountUnverified
+	}
+
+	if !u.EmailVerified {
+		if err := s.repo.ConfirmEmail(u.ID, u.Email); err != nil {
+			return User{}, err
+		}
+		u.EmailVerified = true
+	}
+	return u, s.repo.LinkIdentity(u.ID, provider, subject)
+}
+
+// re-confirms the password of someone who is already logged in
+func (s *Service) CheckPassword(id int, password string) (User, error) {
+	u, err := s.repo.ByID(id)
+	if err != nil {
+		return User{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+func (s *Service) ChangePassword(id int, current, next string) error {
+	if _, err := s.CheckPassword(id, current); err != nil {
+		return err
+	}
+	return s.SetPassword(id, next)
+}
+
+// sets a password without knowing the old one, only for the reset flow
+func (s *Service) SetPassword(id int, password string) error {
+	if password == "" {
+		return ErrInvalidInput
+	}
+
+	u, err := s.repo.ByID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Check(password, u.Email); err != nil {
+		return err
+	}
+
+	hashed, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return s.repo.UpdatePassword(id, hashed)
+}
+
+func (s *Service) ConfirmEmail(id int, email string) error {
+	email = NormalizeEmail(email)
+	if !ValidEmail(email) {
+		return ErrInvalidEmail
+	}
+	return s.repo.ConfirmEmail(id, email)
+}
+
+// drops every external identity linked to the account, e.g. once the owner
+// has taken back an address someone else had been using
+func (s *Service) UnlinkIdentities(id int) error {
+	return s.repo.UnlinkIdentities(id)
+}
+
+func (s *Service) Delete(id int) error {
+	return s.repo.Delete(id)
+}
+
+func (s *Service) ByID(id int) (User, error) {
+	return s.repo.ByID(id)
+}
+
+func (s *Service) ByIdentity(provider, subject string) (User, error) {
+	return s.repo.ByIdentity(provider, subject)
+}
+
+func (s *Service) ByEmail(email string) (User, error) {
+	return s.repo.ByEmail(NormalizeEmail(email))
+}
@@ -0,0 +1,320 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct horse battery"
+
+// min cost keeps the tests fast, the upgrade test raises it
+func newTestService() (*Service, *MemoryRepository) {
+	repo := NewMemoryRepository()
+	return NewService(repo, PasswordPolicy{MinLength: 8, Cost: bcrypt.MinCost}), repo
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     error
+	}{
+		{"ok", "a@example.com", testPassword, nil},
+		{"missing email", "", testPassword, ErrInvalidInput},
+		{"missing password", "a@example.com", "", ErrInvalidInput},
+		{"bad email", "not an email", testPassword, ErrInvalidEmail},
+		{"header injection", "a@example.com\r\nBcc: x@example.com", testPassword, ErrInvalidEmail},
+		{"weak password", "a@example.com", "short", &PasswordError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService()
+			u, err := s.Create(tt.email, tt.password)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+				if u.ID == 0 || u.EmailVerified {
+					t.Errorf("got %+v, want a new unverified user", u)
+				}
+				return
+			}
+			var pe *PasswordError
+			if _, wantPolicy := tt.want.(*PasswordError); wantPolicy {
+				if !errors.As(err, &pe) {
+					t.Errorf("got %v, want a PasswordError", err)
+				}
+				return
+			}
+			if err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateIgnoresEmailCase(t *testing.T) {
+	s, _ := newTestService()
+	u, err := s.Create("  Alice@Example.COM ", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "alice@example.com" {
+		t.Errorf("stored %q, want it normalized", u.Email)
+	}
+	if _, err := s.Create("alice@example.com", testPassword); err != ErrEmailTaken {
+		t.Errorf("second account with the same address: got %v, want ErrEmailTaken", err)
+	}
+	if got, err := s.ByEmail("ALICE@example.com"); err != nil || got.ID != u.ID {
+		t.Errorf("ByEmail = %+v, %v; want user %d", got, err, u.ID)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, _ := newTestService()
+	u, err := s.Create("a@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     error
+	}{
+		{"ok", "a@example.com", testPassword, nil},
+		{"other case", "A@Example.com", testPassword, nil},
+		{"wrong password", "a@example.com", "wrong password", ErrInvalidCredentials},
+		{"unknown email", "b@example.com", testPassword, ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Authenticate(tt.email, tt.password)
+			if err != tt.want {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && got.ID != u.ID {
+				t.Errorf("got user %d, want %d", got.ID, u.ID)
+			}
+		})
+	}
+}
+
+func TestAuthenticateUpgradesCost(t *testing.T) {
+	s, repo := newTestService()
+	u, err := s.Create("a@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.policy.Cost = bcrypt.MinCost + 1
+	if _, err := s.Authenticate("a@example.com", testPassword); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := repo.ByID(u.ID)
+	if cost, _ := bcrypt.Cost([]byte(stored.PasswordHash)); cost != s.policy.Cost {
+		t.Errorf("hash cost %d after login, want %d", cost, s.policy.Cost)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		next    string
+		want    error
+	}{
+		{"ok", testPassword, "another long one", nil},
+		{"wrong current", "wrong password", "another long one", ErrInvalidCredentials},
+		{"too common", testPassword, "password123", &PasswordError{}},
+		{"empty", testPassword, "", ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService()
+			u, err := s.Create("a@example.com", testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.ChangePassword(u.ID, tt.current, tt.next)
+			var pe *PasswordError
+			switch _, wantPolicy := tt.want.(*PasswordError); {
+			case wantPolicy && !errors.As(err, &pe):
+				t.Fatalf("got %v, want a PasswordError", err)
+			case !wantPolicy && err != tt.want:
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+
+			// the old password only stops working if the change went through
+			_, oldErr := s.Authenticate("a@example.com", testPassword)
+			if changed := tt.want == nil; changed != (oldErr != nil) {
+				t.Errorf("old password still works = %v, want %v", oldErr == nil, !changed)
+			}
+			if tt.want == nil {
+				if _, err := s.Authenticate("a@example.com", tt.next); err != nil {
+					t.Errorf("new password: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginWithIdentity(t *testing.T) {
+	tests := []struct {
+		name          string
+		existing      string // email of a password account made first, "" for none
+		verified      bool   // whether that account has confirmed its email
+		email         string // what the provider says
+		emailVerified bool
+		want          error
+		linked        bool // signed into the existing account rather than a new one
+	}{
+		{"new account", "", false, "new@example.com", true, nil, false},
+		{"new account, provider didn't verify", "", false, "new@example.com", false, ErrIdentityEmailUnverified, false},
+		{"links to a verified account", "a@example.com", true, "A@example.com", true, nil, true},
+		{"provider didn't verify the address", "a@example.com", true, "a@example.com", false, ErrIdentityEmailUnverified, false},
+		{"account never verified its address", "a@example.com", false, "a@example.com", true, ErrAccountUnverified, false},
+		{"no email", "", false, "", true, ErrInvalidInput, false},
+		{"bad email", "", false, "nope", true, ErrInvalidEmail, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService()
+			var existing User
+			if tt.existing != "" {
+				var err error
+				if existing, err = s.Create(tt.existing, testPassword); err != nil {
+					t.Fatal(err)
+				}
+				if tt.verified {
+					if err := s.ConfirmEmail(existing.ID, tt.existing); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			u, err := s.LoginWithIdentity("mock", "sub-1", tt.email, tt.emailVerified)
+			if err != tt.want {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				if _, err := s.ByIdentity("mock", "sub-1"); err != ErrNotFound {
+					t.Errorf("identity was linked although the login failed")
+				}
+				if _, err := s.ByEmail(tt.email); tt.existing == "" && err != ErrNotFound {
+					t.Errorf("account was created although the login failed")
+				}
+				return
+			}
+			if tt.linked != (u.ID == existing.ID) {
+				t.Errorf("got user %d, existing account is %d, linked want %v", u.ID, existing.ID, tt.linked)
+			}
+			if u.EmailVerified != tt.emailVerified {
+				t.Errorf("EmailVerified = %v, want %v", u.EmailVerified, tt.emailVerified)
+			}
+
+			// the second time around the identity alone is enough
+			again, err := s.LoginWithIdentity("mock", "sub-1", "", false)
+			if err != nil || again.ID != u.ID {
+				t.Errorf("repeat login = %d, %v; want user %d", again.ID, err, u.ID)
+			}
+		})
+	}
+}
+
+func TestOIDCAccountHasNoPassword(t *testing.T) {
+	s, _ := newTestService()
+	u, err := s.LoginWithIdentity("mock", "sub-1", "a@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate("a@example.com", ""); err != ErrInvalidCredentials {
+		t.Errorf("empty password login: got %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := s.CheckPassword(u.ID, ""); err != ErrInvalidCredentials {
+		t.Errorf("CheckPassword with empty password: got %v, want ErrInvalidCredentials", err)
+	}
+}
+
+// the reset flow's way of taking an address back from whoever linked a login to it
+func TestUnlinkIdentities(t *testing.T) {
+	s, _ := newTestService()
+	u, err := s.LoginWithIdentity("mock", "sub-1", "a@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LoginWithIdentity("other", "sub-2", "a@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UnlinkIdentities(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ByIdentity("mock", "sub-1"); err != ErrNotFound {
+		t.Errorf("mock identity still linked: %v", err)
+	}
+	if _, err := s.ByIdentity("other", "sub-2"); err != ErrNotFound {
+		t.Errorf("other identity still linked: %v", err)
+	}
+	if _, err := s.ByID(u.ID); err != nil {
+		t.Errorf("account went with its identities: %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	s, _ := newTestService()
+	u, err := s.LoginWithIdentity("mock", "sub-1", "a@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ByID(u.ID); err != ErrNotFound {
+		t.Errorf("ByID after delete: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.ByIdentity("mock", "sub-1"); err != ErrNotFound {
+		t.Errorf("ByIdentity after delete: got %v, want ErrNotFound", err)
+	}
+	// the tombstone keeps the address blocked for a while, from either signup
+	if _, err := s.Create("A@example.com", testPassword); err != ErrEmailRecentlyDeleted {
+		t.Errorf("Create after delete: got %v, want ErrEmailRecentlyDeleted", err)
+	}
+	if _, err := s.LoginWithIdentity("other", "sub-2", "a@example.com", true); err != ErrEmailRecentlyDeleted {
+		t.Errorf("LoginWithIdentity after delete: got %v, want ErrEmailRecentlyDeleted", err)
+	}
+	if _, err := s.Create("b@example.com", testPassword); err != nil {
+		t.Errorf("Create with another address: %v", err)
+	}
+
+	// and frees it once the cooldown is over
+	s.ReuseCooldown = 0
+	if _, err := s.Create("a@example.com", testPassword); err != nil {
+		t.Errorf("Create without cooldown: %v", err)
+	}
+}
+
+func TestReuseCooldownFromEnv(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", DefaultReuseCooldown},
+		{"72h", 72 * time.Hour},
+		{"0", 0},
+		{"soon", DefaultReuseCooldown},
+		{"-1h", DefaultReuseCooldown},
+	}
+	for _, tt := range tests {
+		t.Setenv("ACCOUNT_REUSE_COOLDOWN", tt.env)
+		if got := ReuseCooldownFromEnv(); got != tt.want {
+			t.Errorf("ACCOUNT_REUSE_COOLDOWN=%q: got %s, want %s", tt.env, got, tt.want)
+		}
+	}
+}
@@ -1,44 +1,70 @@
-package model
+package user
 
 import (
-	"encoding/json"
-	"itami-hypertrophy/internal/db"
-	"net/http"
-
-	"golang.org/x/crypto/bcrypt"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
 )
 
-type creds struct {
-	ID       int
-	Email    string
-	Password string // hash krenge isko
+type User struct {
+	ID            int
+	Email         string
+	PasswordHash  string
+	EmailVerified bool
 }
 
-func Register(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
-		return
-	}
+var (
+	ErrNotFound           = errors.New("user not found")
+	ErrEmailTaken         = errors.New("email already in use")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidInput       = errors.New("email and password are required")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	// the address belongs to an account that never proved it owns it
+	ErrAccountUnverified = errors.New("account email is not verified")
+	// an external provider vouched for an identity but not for its email
+	ErrIdentityEmailUnverified = errors.New("provider has not verified the email")
+	// the address belonged to an account deleted within the reuse cooldown
+	ErrEmailRecentlyDeleted = errors.New("email belonged to a recently deleted account")
+)
 
-	var c creds
-	err := json.NewDecoder(r.Body).Decode(&c)
-	if err != nil || c.Email == "" || c.Password == "" {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
-		return
-	}
+// emails are stored and looked up in this form, so case never makes two accounts
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(c.Password), bcrypt.DefaultCost)
-	if err != nil {
-		http.Error(w, "Error hashing password", http.StatusInternalServerError)
-		return
-	}
+// what tombstones keep about deleted accounts instead of the address itself
+func HashEmail(email string) string {
+	sum := sha256.Sum256([]byte(NormalizeEmail(email)))
+	return hex.EncodeToString(sum[:])
+}
 
-	_, err = db.DB.Exec("INSERT INTO users (email, password) VALUES ($1, $2)", c.Email, string(hashedPassword))
-	if err != nil {
-		http.Error(w, "Email already in use or DB error", http.StatusInternalServerError)
-		return
+// a bare address ("a@b.com", no display name or <>), it ends up in mail headers
+func ValidEmail(email string) bool {
+	if strings.ContainsAny(email, "\r\n") {
+		return false
 	}
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
 
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("User registered successfully"))
+// storage for users, postgres in the server and an in-memory one for tests/tools
+type Repository interface {
+	Create(email, passwordHash string) (User, error)
+	ByID(id int) (User, error)
+	ByEmail(email string) (User, error)
+	UpdatePassword(id int, passwordHash string) error
+	// sets the (possibly new) email and marks it verified
+	ConfirmEmail(id int, email string) error
+	// removes the user and everything tied to it, leaving a tombstone
+	Delete(id int) error
+	// whether an account with this email was deleted after since
+	DeletedSince(email string, since time.Time) (bool, error)
+	// users signed in through an external (oidc) provider, keyed by the
+	// provider name and the provider's subject id
+	ByIdentity(provider, subject string) (User, error)
+	LinkIdentity(id int, provider, subject string) error
+	UnlinkIdentities(id int) error
 }
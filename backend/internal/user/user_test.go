@@ -0,0 +1,42 @@
+package user
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a@example.com", "a@example.com"},
+		{"A@Example.COM", "a@example.com"},
+		{"  a@example.com\t", "a@example.com"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeEmail(tt.in); got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"a@example.com", true},
+		{"first.last+tag@sub.example.com", true},
+		{"", false},
+		{"no-at-sign", false},
+		{"@example.com", false},
+		{"Alice <a@example.com>", false},
+		{"<a@example.com>", false},
+		{"a@example.com\r\nBcc: b@example.com", false},
+		{"a@example.com\n", false},
+		{"a@example.com, b@example.com", false},
+	}
+	for _, tt := range tests {
+		if got := ValidEmail(tt.email); got != tt.want {
+			t.Errorf("ValidEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
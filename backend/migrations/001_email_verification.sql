@@ -0,0 +1,5 @@
+-- users have to confirm their email before the account is fully usable
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- accounts that existed before verification was a thing are trusted as-is
+UPDATE users SET email_verified = TRUE;
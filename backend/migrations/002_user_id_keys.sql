@@ -0,0 +1,34 @@
+-- key every per-user table on users.id instead of email, so an email can change
+BEGIN;
+
+ALTER TABLE meals ADD COLUMN IF NOT EXISTS user_id INTEGER;
+ALTER TABLE strength_workouts ADD COLUMN IF NOT EXISTS user_id INTEGER;
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS user_id INTEGER;
+
+UPDATE meals m SET user_id = u.id FROM users u WHERE m.user_id IS NULL AND m.email = u.email;
+UPDATE strength_workouts s SET user_id = u.id FROM users u WHERE s.user_id IS NULL AND s.email = u.email;
+UPDATE goals g SET user_id = u.id FROM users u WHERE g.user_id IS NULL AND g.email = u.email;
+
+-- rows whose email never matched a user can't be attributed to anyone
+DELETE FROM meals WHERE user_id IS NULL;
+DELETE FROM strength_workouts WHERE user_id IS NULL;
+DELETE FROM goals WHERE user_id IS NULL;
+
+ALTER TABLE meals
+    ALTER COLUMN user_id SET NOT NULL,
+    ADD CONSTRAINT meals_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    DROP COLUMN email;
+ALTER TABLE strength_workouts
+    ALTER COLUMN user_id SET NOT NULL,
+    ADD CONSTRAINT strength_workouts_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    DROP COLUMN email;
+ALTER TABLE goals
+    ALTER COLUMN user_id SET NOT NULL,
+    ADD CONSTRAINT goals_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    ADD CONSTRAINT goals_user_id_key UNIQUE (user_id),
+    DROP COLUMN email;
+
+CREATE INDEX IF NOT EXISTS meals_user_id_created_at_idx ON meals (user_id, created_at);
+CREATE INDEX IF NOT EXISTS strength_workouts_user_id_created_at_idx ON strength_workouts (user_id, created_at);
+
+COMMIT;
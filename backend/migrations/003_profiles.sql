@@ -0,0 +1,15 @@
+-- one profile row per user; body measurements are stored metric and
+-- converted for display according to the preferred units
+CREATE TABLE IF NOT EXISTS profiles (
+    user_id       INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    display_name  TEXT,
+    sex           TEXT CHECK (sex IN ('male', 'female', 'other')),
+    birth_date    DATE,
+    height_cm     DOUBLE PRECISION CHECK (height_cm > 0),
+    bodyweight_kg DOUBLE PRECISION CHECK (bodyweight_kg > 0),
+    weight_unit   TEXT NOT NULL DEFAULT 'kg' CHECK (weight_unit IN ('kg', 'lb')),
+    height_unit   TEXT NOT NULL DEFAULT 'cm' CHECK (height_unit IN ('cm', 'in')),
+    timezone      TEXT NOT NULL DEFAULT 'UTC',
+    week_start    TEXT NOT NULL DEFAULT 'monday',
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+-- a record that an account existed and was deleted. only a hash of the
+-- email is kept, enough for signups to tell that the address belonged to an
+-- account deleted a moment ago (see user.Service.ReuseCooldown)
+CREATE TABLE IF NOT EXISTS account_tombstones (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    email_hash TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS account_tombstones_email_hash_idx ON account_tombstones (email_hash, deleted_at);
@@ -0,0 +1,31 @@
+-- coach ↔ athlete links. a coach invites, the athlete accepts, and from then on
+-- the coach can read (never write) the athlete's data until either side ends it
+CREATE TABLE IF NOT EXISTS coach_links (
+    id          SERIAL PRIMARY KEY,
+    coach_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    athlete_id  INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status      TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'active', 'declined', 'ended')),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMPTZ,
+    ended_at    TIMESTAMPTZ,
+    CHECK (coach_id <> athlete_id)
+);
+
+-- at most one open (pending or active) link per pair
+CREATE UNIQUE INDEX IF NOT EXISTS coach_links_open_pair_idx
+    ON coach_links (coach_id, athlete_id) WHERE status IN ('pending', 'active');
+
+-- every request a coach makes on an athlete's behalf. the coach's email is
+-- copied in so the entry still says who it was after the coach deletes their
+-- account, which only clears coach_id
+CREATE TABLE IF NOT EXISTS coach_access_log (
+    id          SERIAL PRIMARY KEY,
+    coach_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    coach_email TEXT NOT NULL,
+    athlete_id  INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    method      TEXT NOT NULL,
+    path        TEXT NOT NULL,
+    accessed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS coach_access_log_athlete_idx ON coach_access_log (athlete_id, accessed_at);
@@ -0,0 +1,26 @@
+-- local food database (filled by cmd/importfoods from the USDA FoodData
+-- Central bulk downloads) so meals can be looked up without nutritionix.
+-- macros are per 100 g, portions say how many grams one cup/slice/... is
+CREATE TABLE IF NOT EXISTS foods (
+    id        SERIAL PRIMARY KEY,
+    fdc_id    INTEGER NOT NULL UNIQUE,
+    name      TEXT NOT NULL,
+    data_type TEXT NOT NULL,
+    calories  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    protein   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    carbs     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    fat       DOUBLE PRECISION NOT NULL DEFAULT 0,
+    search    TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', name)) STORED
+);
+
+CREATE INDEX IF NOT EXISTS foods_search_idx ON foods USING GIN (search);
+
+CREATE TABLE IF NOT EXISTS food_portions (
+    id      SERIAL PRIMARY KEY,
+    food_id INTEGER NOT NULL REFERENCES foods(id) ON DELETE CASCADE,
+    seq     INTEGER NOT NULL DEFAULT 0,
+    label   TEXT NOT NULL,
+    grams   DOUBLE PRECISION NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS food_portions_food_id_idx ON food_portions (food_id);
@@ -0,0 +1,19 @@
+-- the foods a meal was made of, one row each. meals keeps the totals (sum of
+-- its items) so the dashboards don't need to join; older meals have no items
+ALTER TABLE meals ADD COLUMN IF NOT EXISTS id SERIAL PRIMARY KEY;
+
+CREATE TABLE IF NOT EXISTS meal_items (
+    id       SERIAL PRIMARY KEY,
+    meal_id  INTEGER NOT NULL REFERENCES meals(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    name     TEXT NOT NULL,
+    quantity DOUBLE PRECISION NOT NULL DEFAULT 0,
+    unit     TEXT NOT NULL DEFAULT '',
+    grams    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    calories DOUBLE PRECISION NOT NULL DEFAULT 0,
+    protein  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    carbs    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    fat      DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS meal_items_meal_id_idx ON meal_items (meal_id);
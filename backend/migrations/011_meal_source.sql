@@ -0,0 +1,7 @@
+-- where a meal's macros came from: 'estimated' by the nutrition provider or
+-- 'manual' when the user typed them in (e.g. off a label). existing rows were
+-- all looked up
+ALTER TABLE meals ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'estimated';
+
+ALTER TABLE meals DROP CONSTRAINT IF EXISTS meals_source_check;
+ALTER TABLE meals ADD CONSTRAINT meals_source_check CHECK (source IN ('estimated', 'manual'));
@@ -0,0 +1,7 @@
+-- breakfast/lunch/... so a day can be broken down by meal. meals logged
+-- before this (or without a type) end up as 'other'
+ALTER TABLE meals ADD COLUMN IF NOT EXISTS meal_type TEXT NOT NULL DEFAULT 'other';
+
+ALTER TABLE meals DROP CONSTRAINT IF EXISTS meals_meal_type_check;
+ALTER TABLE meals ADD CONSTRAINT meals_meal_type_check
+    CHECK (meal_type IN ('breakfast', 'lunch', 'dinner', 'snack', 'pre_workout', 'post_workout', 'other'));
@@ -0,0 +1,32 @@
+-- saved meals / recipes. the ingredients are looked up once when the recipe
+-- is created, logging it later just copies them (scaled) into a meal
+CREATE TABLE IF NOT EXISTS recipes (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name       TEXT NOT NULL,
+    servings   DOUBLE PRECISION NOT NULL CHECK (servings > 0), -- how many servings the ingredients make
+    -- per serving, the ingredients below are for the whole recipe
+    calories   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    protein    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    carbs      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    fat        DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS recipes_user_id_idx ON recipes (user_id);
+
+CREATE TABLE IF NOT EXISTS recipe_ingredients (
+    id        SERIAL PRIMARY KEY,
+    recipe_id INTEGER NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+    position  INTEGER NOT NULL DEFAULT 0,
+    name      TEXT NOT NULL,
+    quantity  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    unit      TEXT NOT NULL DEFAULT '',
+    grams     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    calories  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    protein   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    carbs     DOUBLE PRECISION NOT NULL DEFAULT 0,
+    fat       DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS recipe_ingredients_recipe_id_idx ON recipe_ingredients (recipe_id);
@@ -0,0 +1,6 @@
+-- emails are compared case-insensitively: stored lowercased from now on, and
+-- the index keeps "Alice@x.com" and "alice@x.com" from both existing. if this
+-- fails on the UPDATE, two accounts differ only by case and have to be merged by hand
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_idx ON users (lower(email));
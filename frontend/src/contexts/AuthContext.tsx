@@ -1,14 +1,19 @@
 import * as React from 'react';
 import { createContext, useContext, useState, useEffect, ReactNode } from 'react';
-import { api } from '../services/api';
+import { api, csrfHeaders, isCookieMode, rememberAuthMode } from '../services/api';
 
 interface User {
   email: string;
 }
 
+// with 2FA on, /login only answers with a short-lived challenge and the
+// session comes from /login/mfa once the code is in
+export type LoginResult = { mfaRequired: false } | { mfaRequired: true; mfaToken: string };
+
 interface AuthContextType {
   user: User | null;
-  login: (email: string, password: string) => Promise<void>;
+  login: (email: string, password: string) => Promise<LoginResult>;
+  loginMFA: (email: string, mfaToken: string, code: string) => Promise<void>;
   register: (email: string, password: string) => Promise<void>;
   logout: () => void;
   isLoading: boolean;
@@ -34,8 +39,10 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
 
   useEffect(() => {
     const token = localStorage.getItem('token');
-    if (token) {
-      api.defaults.headers.common['Authorization'] = `Bearer ${token}`;
+    if (token || isCookieMode()) {
+      if (token) {
+        api.defaults.headers.common['Authorization'] = `Bearer ${token}`;
+      }
       // You could verify the token here if needed
       const email = localStorage.getItem('userEmail');
       if (email) {
@@ -45,19 +52,34 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     setIsLoading(false);
   }, []);
 
-  const login = async (email: string, password: string) => {
-    try {
-      const response = await api.post('/login', { email, password });
-      const { token } = response.data;
-      
+  // same session response from /login and /login/mfa
+  const startSession = (email: string, data: any) => {
+    rememberAuthMode(data);
+
+    // in cookie mode the backend keeps the tokens in HttpOnly cookies
+    if (!isCookieMode()) {
+      const { token, refresh_token } = data;
       localStorage.setItem('token', token);
-      localStorage.setItem('userEmail', email);
+      localStorage.setItem('refreshToken', refresh_token);
       api.defaults.headers.common['Authorization'] = `Bearer ${token}`;
-      
-      setUser({ email });
-    } catch (error) {
-      throw error;
     }
+    localStorage.setItem('userEmail', email);
+
+    setUser({ email });
+  };
+
+  const login = async (email: string, password: string): Promise<LoginResult> => {
+    const response = await api.post('/login', { email, password });
+    if (response.data.mfa_required) {
+      return { mfaRequired: true, mfaToken: response.data.mfa_token };
+    }
+    startSession(email, response.data);
+    return { mfaRequired: false };
+  };
+
+  const loginMFA = async (email: string, mfaToken: string, code: string) => {
+    const response = await api.post('/login/mfa', { mfa_token: mfaToken, code });
+    startSession(email, response.data);
   };
 
   const register = async (email: string, password: string) => {
@@ -69,8 +91,19 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   };
 
   const logout = () => {
+    const token = localStorage.getItem('token');
+    if (isCookieMode()) {
+      // the session cookies go along by themselves, the CSRF header has to be explicit
+      api.post('/logout', null, { headers: csrfHeaders() }).catch(() => {});
+    } else if (token) {
+      api
+        .post('/logout', null, { headers: { Authorization: `Bearer ${token}` } })
+        .catch(() => {});
+    }
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     localStorage.removeItem('userEmail');
+    localStorage.removeItem('authMode');
     delete api.defaults.headers.common['Authorization'];
     setUser(null);
   };
@@ -78,6 +111,7 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   const value = {
     user,
     login,
+    loginMFA,
     register,
     logout,
     isLoading,
@@ -11,10 +11,18 @@ interface LoginForm {
   password: string;
 }
 
+// set when the password was right but the account has 2FA on
+interface MFAStep {
+  email: string;
+  mfaToken: string;
+}
+
 const Login: React.FC = () => {
   const [showPassword, setShowPassword] = useState(false);
   const [isLoading, setIsLoading] = useState(false);
-  const { login } = useAuth();
+  const [mfaStep, setMFAStep] = useState<MFAStep | null>(null);
+  const [code, setCode] = useState('');
+  const { login, loginMFA } = useAuth();
   const navigate = useNavigate();
 
   const {
@@ -26,7 +34,11 @@ const Login: React.FC = () => {
   const onSubmit = async (data: LoginForm) => {
     setIsLoading(true);
     try {
-      await login(data.email, data.password);
+      const result = await login(data.email, data.password);
+      if (result.mfaRequired) {
+        setMFAStep({ email: data.email, mfaToken: result.mfaToken });
+        return;
+      }
       toast.success('Welcome back!');
       navigate('/dashboard');
     } catch (error: any) {
@@ -36,6 +48,29 @@ const Login: React.FC = () => {
     }
   };
 
+  const onSubmitCode = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!mfaStep) return;
+    setIsLoading(true);
+    try {
+      await loginMFA(mfaStep.email, mfaStep.mfaToken, code.trim());
+      toast.success('Welcome back!');
+      navigate('/dashboard');
+    } catch (error: any) {
+      // only a wrong code can be retried, an expired challenge or too many
+      // tries mean the password has to go in again
+      const wrongCode =
+        error.response?.status === 401 && !String(error.response?.data).includes('MFA token');
+      if (!wrongCode) {
+        setMFAStep(null);
+      }
+      setCode('');
+      toast.error(error.response?.data || 'Verification failed');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   return (
     <div className="min-h-screen gradient-bg flex items-center justify-center px-4">
       <div className="max-w-md w-full space-y-8">
@@ -50,76 +85,119 @@ const Login: React.FC = () => {
 
         {/* Form */}
         <div className="card">
-          <form className="space-y-6" onSubmit={handleSubmit(onSubmit)}>
-            <div>
-              <label htmlFor="email" className="block text-sm font-medium text-gray-700 mb-2">
-                Email address
-              </label>
-              <input
-                {...register('email', {
-                  required: 'Email is required',
-                  pattern: {
-                    value: /^[A-Z0-9._%+-]+@[A-Z0-9.-]+\.[A-Z]{2,}$/i,
-                    message: 'Invalid email address',
-                  },
-                })}
-                type="email"
-                id="email"
-                className="input-field"
-                placeholder="Enter your email"
-              />
-              {errors.email && (
-                <p className="mt-1 text-sm text-danger-600">{errors.email.message}</p>
-              )}
-            </div>
+          {mfaStep ? (
+            <form className="space-y-6" onSubmit={onSubmitCode}>
+              <div>
+                <label htmlFor="code" className="block text-sm font-medium text-gray-700 mb-2">
+                  Authentication code
+                </label>
+                <input
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                  type="text"
+                  id="code"
+                  autoComplete="one-time-code"
+                  autoFocus
+                  className="input-field"
+                  placeholder="6-digit code or a recovery code"
+                />
+              </div>
 
-            <div>
-              <label htmlFor="password" className="block text-sm font-medium text-gray-700 mb-2">
-                Password
-              </label>
-              <div className="relative">
+              <button
+                type="submit"
+                disabled={isLoading || code.trim() === ''}
+                className="btn-primary w-full flex items-center justify-center"
+              >
+                {isLoading ? (
+                  <div className="animate-spin rounded-full h-5 w-5 border-b-2 border-white"></div>
+                ) : (
+                  'Verify'
+                )}
+              </button>
+
+              <button
+                type="button"
+                className="w-full text-sm text-gray-600 hover:text-gray-900"
+                onClick={() => {
+                  setMFAStep(null);
+                  setCode('');
+                }}
+              >
+                Back to sign in
+              </button>
+            </form>
+          ) : (
+            <form className="space-y-6" onSubmit={handleSubmit(onSubmit)}>
+              <div>
+                <label htmlFor="email" className="block text-sm font-medium text-gray-700 mb-2">
+                  Email address
+                </label>
                 <input
-                  {...register('password', {
-                    required: 'Password is required',
-                    minLength: {
-                      value: 6,
-                      message: 'Password must be at least 6 characters',
+                  {...register('email', {
+                    required: 'Email is required',
+                    pattern: {
+                      value: /^[A-Z0-9._%+-]+@[A-Z0-9.-]+\.[A-Z]{2,}$/i,
+                      message: 'Invalid email address',
                     },
                   })}
-                  type={showPassword ? 'text' : 'password'}
-                  id="password"
-                  className="input-field pr-10"
-                  placeholder="Enter your password"
+                  type="email"
+                  id="email"
+                  className="input-field"
+                  placeholder="Enter your email"
                 />
-                <button
-                  type="button"
-                  className="absolute inset-y-0 right-0 pr-3 flex items-center"
-                  onClick={() => setShowPassword(!showPassword)}
-                >
-                  {showPassword ? (
-                    <EyeOff className="h-5 w-5 text-gray-400" />
-                  ) : (
-                    <Eye className="h-5 w-5 text-gray-400" />
-                  )}
-                </button>
+                {errors.email && (
+                  <p className="mt-1 text-sm text-danger-600">{errors.email.message}</p>
+                )}
               </div>
-              {errors.password && (
-                <p className="mt-1 text-sm text-danger-600">{errors.password.message}</p>
-              )}
-            </div>
 
-            <button
-              type="submit"
-              disabled={isLoading}
-              className="btn-primary w-full flex items-center justify-center"
-            >
-              {isLoading ? (
-                <div className="animate-spin rounded-full h-5 w-5 border-b-2 border-white"></div>
-              ) : (
-                'Sign in'
-              )}
-            </button>
-          </form>
+              <div>
+                <label htmlFor="password" className="block text-sm font-medium text-gray-700 mb-2">
+                  Password
+                </label>
+                <div className="relative">
+                  <input
+                    {...register('password', {
+                      required: 'Password is required',
+                      minLength: {
+                        value: 6,
+                        message: 'Password must be at least 6 characters',
+                      },
+                    })}
+                    type={showPassword ? 'text' : 'password'}
+                    id="password"
+                    className="input-field pr-10"
+                    placeholder="Enter your password"
+                  />
+                  <button
+                    type="button"
+                    className="absolute inset-y-0 right-0 pr-3 flex items-center"
+                    onClick={() => setShowPassword(!showPassword)}
+                  >
+                    {showPassword ? (
+                      <EyeOff className="h-5 w-5 text-gray-400" />
+                    ) : (
+                      <Eye className="h-5 w-5 text-gray-400" />
+                    )}
+                  </button>
+                </div>
+                {errors.password && (
+                  <p className="mt-1 text-sm text-danger-600">{errors.password.message}</p>
+                )}
+              </div>
+
+              <button
+                type="submit"
+                disabled={isLoading}
+                className="btn-primary w-full flex items-center justify-center"
+              >
+                {isLoading ? (
+                  <div className="animate-spin rounded-full h-5 w-5 border-b-2 border-white"></div>
+                ) : (
+                  'Sign in'
+                )}
+              </button>
+            </form>
+          )}
 
           <div className="mt-6 text-center">
             <p className="text-sm text-gray-600">
@@ -2,14 +2,47 @@ import axios from 'axios';
 
 export const api = axios.create({
   baseURL: '/api',
+  withCredentials: true,
   headers: {
     'Content-Type': 'application/json',
   },
 });
 
-// Request interceptor to add auth token
+// When the backend runs with AUTH_MODE=cookie, login/refresh answer with a
+// csrf_token instead of tokens and the session lives in HttpOnly cookies.
+export const isCookieMode = () => localStorage.getItem('authMode') === 'cookie';
+
+// Remember which mode the backend answered in (called after login)
+export const rememberAuthMode = (data: { token?: string; csrf_token?: string }) => {
+  if (!data.token && data.csrf_token) {
+    localStorage.setItem('authMode', 'cookie');
+  } else {
+    localStorage.removeItem('authMode');
+  }
+};
+
+const readCookie = (name: string) => {
+  const match = document.cookie.split('; ').find((c) => c.startsWith(`${name}=`));
+  return match ? decodeURIComponent(match.split('=')[1]) : null;
+};
+
+export const csrfHeaders = (): Record<string, string> => {
+  const csrf = readCookie('itami_csrf');
+  return csrf ? { 'X-CSRF-Token': csrf } : {};
+};
+
+const isSafeMethod = (method?: string) =>
+  ['get', 'head', 'options'].includes((method || 'get').toLowerCase());
+
+// Request interceptor to add auth token (or the CSRF token in cookie mode)
 api.interceptors.request.use(
   (config) => {
+    if (isCookieMode()) {
+      if (!isSafeMethod(config.method)) {
+        Object.assign(config.headers, csrfHeaders());
+      }
+      return config;
+    }
     const token = localStorage.getItem('token');
     if (token) {
       config.headers.Authorization = `Bearer ${token}`;
@@ -21,15 +54,65 @@ api.interceptors.request.use(
   }
 );
 
+const clearSession = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
+  localStorage.removeItem('userEmail');
+  localStorage.removeItem('authMode');
+  window.location.href = '/login';
+};
+
+let refreshing: Promise<string | null> | null = null;
+
+// Swap the stored refresh token for a new token pair (shared by concurrent 401s).
+// In cookie mode the refresh token is a cookie and the new pair comes back as cookies.
+const refreshAccessToken = () => {
+  if (!refreshing) {
+    const request = isCookieMode()
+      ? axios.post('/api/token/refresh', null, { withCredentials: true, headers: csrfHeaders() })
+      : axios.post('/api/token/refresh', { refresh_token: localStorage.getItem('refreshToken') });
+
+    refreshing = request
+      .then((response) => {
+        if (isCookieMode()) {
+          return null;
+        }
+        const { token, refresh_token } = response.data;
+        localStorage.setItem('token', token);
+        localStorage.setItem('refreshToken', refresh_token);
+        api.defaults.headers.common['Authorization'] = `Bearer ${token}`;
+        return token as string;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+const canRefresh = () => isCookieMode() || !!localStorage.getItem('refreshToken');
+
 // Response interceptor for error handling
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config;
     if (error.response?.status === 401) {
-      localStorage.removeItem('token');
-      localStorage.removeItem('userEmail');
-      window.location.href = '/login';
+      if (original && !original._retry && canRefresh()) {
+        original._retry = true;
+        try {
+          const token = await refreshAccessToken();
+          if (token) {
+            original.headers.Authorization = `Bearer ${token}`;
+          }
+          return api(original);
+        } catch {
+          clearSession();
+        }
+      } else {
+        clearSession();
+      }
     }
     return Promise.reject(error);
   }
-); 
\ No newline at end of file
+);